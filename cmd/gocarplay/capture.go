@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// captureReader copies what is read from the dongle to a capture file. A
+// failed write ends the capture, as the file would miss frames from then on,
+// and calls stop with the error. Reads go on without the capture.
+type captureReader struct {
+	r    io.Reader
+	f    *os.File
+	stop context.CancelCauseFunc
+	err  error
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 && c.err == nil {
+		if _, werr := c.f.Write(p[:n]); werr != nil {
+			c.err = fmt.Errorf("capture: %w", werr)
+			c.stop(c.err)
+		}
+	}
+	return n, err
+}
+
+// Close flushes the capture file to disk and closes it.
+func (c *captureReader) Close() error {
+	if err := c.f.Sync(); err != nil {
+		c.f.Close()
+		return err
+	}
+	return c.f.Close()
+}
+
+// nopCloser is returned as the capture when there is none.
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// stopCause returns the error ctx was stopped with, or nil when it was only
+// cancelled.
+func stopCause(ctx context.Context) error {
+	if err := context.Cause(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
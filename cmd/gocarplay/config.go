@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/recorder"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variable of each flag, e.g.
+// GOCARPLAY_LOG_LEVEL for -log-level.
+const envPrefix = "GOCARPLAY_"
+
+// Config is the configuration of gocarplay. It is read from the file given by
+// -config, then environment variables and then flags, each overriding the last.
+type Config struct {
+	Listen  string `yaml:"listen" toml:"listen"`
+	FPS     int32  `yaml:"fps" toml:"fps"`
+	DPI     int32  `yaml:"dpi" toml:"dpi"`
+	Width   int32  `yaml:"width" toml:"width"`
+	Height  int32  `yaml:"height" toml:"height"`
+	Capture string `yaml:"capture,omitempty" toml:"capture,omitempty"`
+
+	Dongle DongleConfig `yaml:"dongle" toml:"dongle"`
+	Navi   NaviConfig   `yaml:"navi" toml:"navi"`
+	ICE    ICEConfig    `yaml:"ice" toml:"ice"`
+	Log    LogConfig    `yaml:"log" toml:"log"`
+	TLS    TLSConfig    `yaml:"tls" toml:"tls"`
+	Auth   AuthConfig   `yaml:"auth" toml:"auth"`
+	Record RecordConfig `yaml:"record" toml:"record"`
+}
+
+type DongleConfig struct {
+	VendorID      uint16 `yaml:"vendorID" toml:"vendorID"`
+	ProductID     uint16 `yaml:"productID" toml:"productID"`
+	NightMode     int32  `yaml:"nightMode" toml:"nightMode"`
+	HandDriveMode int32  `yaml:"handDriveMode" toml:"handDriveMode"`
+	ChargeMode    int32  `yaml:"chargeMode" toml:"chargeMode"`
+	BoxName       string `yaml:"boxName" toml:"boxName"`
+	MediaDelay    int32  `yaml:"mediaDelay,omitempty" toml:"mediaDelay,omitempty"`
+	MicType       int32  `yaml:"micType" toml:"micType"`
+	Wireless      bool   `yaml:"wireless" toml:"wireless"`
+	WifiBand      string `yaml:"wifiBand" toml:"wifiBand"`
+	WifiChannel   int32  `yaml:"wifiChannel,omitempty" toml:"wifiChannel,omitempty"`
+	// WorkMode is carplay or androidauto.
+	WorkMode       string `yaml:"workMode" toml:"workMode"`
+	AndroidAutoDPI int32  `yaml:"androidAutoDPI,omitempty" toml:"androidAutoDPI,omitempty"`
+}
+
+// NaviConfig is the navigation video, sent by newer dongles for instrument
+// clusters and head-up displays. It is disabled when the size is zero.
+type NaviConfig struct {
+	Width  int32 `yaml:"width,omitempty" toml:"width,omitempty"`
+	Height int32 `yaml:"height,omitempty" toml:"height,omitempty"`
+	FPS    int32 `yaml:"fps" toml:"fps"`
+}
+
+type ICEConfig struct {
+	// Servers are STUN or TURN URLs. Leave empty for LAN-only networks.
+	Servers    []string `yaml:"servers" toml:"servers"`
+	Username   string   `yaml:"username,omitempty" toml:"username,omitempty"`
+	Credential string   `yaml:"credential,omitempty" toml:"credential,omitempty"`
+	NAT1To1IPs []string `yaml:"nat1To1IPs,omitempty" toml:"nat1To1IPs,omitempty"`
+	UDPPortMin uint16   `yaml:"udpPortMin,omitempty" toml:"udpPortMin,omitempty"`
+	UDPPortMax uint16   `yaml:"udpPortMax,omitempty" toml:"udpPortMax,omitempty"`
+	Lite       bool     `yaml:"lite" toml:"lite"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+type TLSConfig struct {
+	Enabled      bool   `yaml:"enabled" toml:"enabled"`
+	Cert         string `yaml:"cert,omitempty" toml:"cert,omitempty"`
+	Key          string `yaml:"key,omitempty" toml:"key,omitempty"`
+	Dir          string `yaml:"dir" toml:"dir"`
+	ClientCA     string `yaml:"clientCA,omitempty" toml:"clientCA,omitempty"`
+	HTTPRedirect string `yaml:"httpRedirect,omitempty" toml:"httpRedirect,omitempty"`
+}
+
+type AuthConfig struct {
+	Token     string `yaml:"token,omitempty" toml:"token,omitempty"`
+	ViewToken string `yaml:"viewToken,omitempty" toml:"viewToken,omitempty"`
+}
+
+type RecordConfig struct {
+	Dir         string   `yaml:"dir" toml:"dir"`
+	Format      string   `yaml:"format" toml:"format"`
+	MaxSize     int64    `yaml:"maxSize,omitempty" toml:"maxSize,omitempty"`
+	MaxDuration Duration `yaml:"maxDuration,omitempty" toml:"maxDuration,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "10m" in config files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = Duration(v)
+	return err
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Listen: ":8001",
+		FPS:    25,
+		DPI:    160,
+		Dongle: DongleConfig{
+			VendorID:      uint16(link.DefaultVendorID),
+			ProductID:     uint16(link.DefaultProductID),
+			NightMode:     link.DefaultDongleConfig.NightMode,
+			HandDriveMode: link.DefaultDongleConfig.HandDriveMode,
+			ChargeMode:    link.DefaultDongleConfig.ChargeMode,
+			BoxName:       link.DefaultDongleConfig.BoxName,
+			MediaDelay:    link.DefaultDongleConfig.MediaDelay,
+			MicType:       link.DefaultDongleConfig.MicType,
+			Wireless:      link.DefaultDongleConfig.Wireless,
+			WifiBand:      string(link.DefaultDongleConfig.WifiBand),
+			WifiChannel:   link.DefaultDongleConfig.WifiChannel,
+			WorkMode:      link.DefaultDongleConfig.WorkMode.String(),
+		},
+		Navi: NaviConfig{
+			FPS: 15,
+		},
+		ICE: ICEConfig{
+			Servers: []string{"stun:stun.l.google.com:19302"},
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		TLS: TLSConfig{
+			Enabled: true,
+			Dir:     "./certs",
+		},
+		Record: RecordConfig{
+			Dir:    "./recordings",
+			Format: recorder.FormatMP4.String(),
+		},
+	}
+}
+
+// flags registers a flag for every setting of cfg.
+func (cfg *Config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "address to serve on")
+	fs.Var(int32Value{&cfg.FPS}, "fps", "video frame rate")
+	fs.Var(int32Value{&cfg.DPI}, "dpi", "screen DPI")
+	fs.Var(int32Value{&cfg.Width}, "width", "screen width used when no browser sets it, 1280 when 0; when set, WHEP players start the dongle")
+	fs.Var(int32Value{&cfg.Height}, "height", "screen height used when no browser sets it, 720 when 0")
+	fs.StringVar(&cfg.Capture, "capture", cfg.Capture, "file to capture the data received from the dongle to")
+
+	fs.Var(uint16Value{&cfg.Dongle.VendorID}, "dongle-vid", "USB vendor ID of the dongle")
+	fs.Var(uint16Value{&cfg.Dongle.ProductID}, "dongle-pid", "USB product ID of the dongle")
+	fs.Var(int32Value{&cfg.Dongle.NightMode}, "dongle-night-mode", "0 for day, 1 for night, 2 to follow the phone")
+	fs.Var(int32Value{&cfg.Dongle.HandDriveMode}, "dongle-hand-drive-mode", "0 for left hand drive, 1 for right hand drive")
+	fs.Var(int32Value{&cfg.Dongle.ChargeMode}, "dongle-charge-mode", "0 for slow, 1 for fast charging")
+	fs.StringVar(&cfg.Dongle.BoxName, "dongle-box-name", cfg.Dongle.BoxName, "name the dongle advertises to phones")
+	fs.Var(int32Value{&cfg.Dongle.MediaDelay}, "dongle-media-delay", "audio buffering of the dongle in milliseconds, 0 for its default")
+	fs.Var(int32Value{&cfg.Dongle.MicType}, "dongle-mic-type", "0 for the head unit's microphone, 1 for the dongle's")
+	fs.BoolVar(&cfg.Dongle.Wireless, "dongle-wireless", cfg.Dongle.Wireless, "enable wireless CarPlay on dongles supporting it")
+	fs.StringVar(&cfg.Dongle.WifiBand, "dongle-wifi-band", cfg.Dongle.WifiBand, "Wi-Fi band of the dongle, 2.4GHz or 5GHz, or empty to leave it to the firmware")
+	fs.Var(int32Value{&cfg.Dongle.WifiChannel}, "dongle-wifi-channel", "Wi-Fi channel of the dongle, 0 for its default")
+	fs.StringVar(&cfg.Dongle.WorkMode, "dongle-work-mode", cfg.Dongle.WorkMode, "carplay, or androidauto for Android phones to connect with Android Auto")
+	fs.Var(int32Value{&cfg.Dongle.AndroidAutoDPI}, "dongle-android-auto-dpi", "DPI Android Auto renders at, 0 for -dpi")
+
+	fs.Var(int32Value{&cfg.Navi.Width}, "navi-width", "width of the navigation video, 0 to disable it")
+	fs.Var(int32Value{&cfg.Navi.Height}, "navi-height", "height of the navigation video")
+	fs.Var(int32Value{&cfg.Navi.FPS}, "navi-fps", "frame rate of the navigation video")
+
+	fs.Var((*listValue)(&cfg.ICE.Servers), "ice-servers", "comma separated STUN/TURN URLs, empty for LAN-only networks")
+	fs.StringVar(&cfg.ICE.Username, "ice-username", cfg.ICE.Username, "TURN user name")
+	fs.StringVar(&cfg.ICE.Credential, "ice-credential", cfg.ICE.Credential, "TURN credential")
+	fs.Var((*listValue)(&cfg.ICE.NAT1To1IPs), "ice-nat-1to1-ips", "comma separated public IPs of a 1:1 NAT")
+	fs.Var(uint16Value{&cfg.ICE.UDPPortMin}, "ice-udp-port-min", "lowest UDP port for ICE")
+	fs.Var(uint16Value{&cfg.ICE.UDPPortMax}, "ice-udp-port-max", "highest UDP port for ICE")
+	fs.BoolVar(&cfg.ICE.Lite, "ice-lite", cfg.ICE.Lite, "run as an ICE lite agent")
+
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "debug, info, warn or error")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "json or text")
+
+	fs.BoolVar(&cfg.TLS.Enabled, "tls", cfg.TLS.Enabled, "serve HTTPS")
+	fs.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "PEM certificate file, a self-signed one is created when empty")
+	fs.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "PEM key file of -tls-cert")
+	fs.StringVar(&cfg.TLS.Dir, "tls-dir", cfg.TLS.Dir, "directory for the self-signed CA and certificate")
+	fs.StringVar(&cfg.TLS.ClientCA, "tls-client-ca", cfg.TLS.ClientCA, "PEM CA file; clients presenting a certificate it issued may control the phone")
+	fs.StringVar(&cfg.TLS.HTTPRedirect, "http-redirect", cfg.TLS.HTTPRedirect, "address to redirect HTTP to HTTPS on, e.g. :8000")
+
+	fs.StringVar(&cfg.Auth.Token, "token", cfg.Auth.Token, "token required to control the phone")
+	fs.StringVar(&cfg.Auth.ViewToken, "view-token", cfg.Auth.ViewToken, "token required to watch")
+
+	fs.StringVar(&cfg.Record.Dir, "record-dir", cfg.Record.Dir, "directory recordings are written to")
+	fs.StringVar(&cfg.Record.Format, "record-format", cfg.Record.Format, "mp4 or mkv")
+	fs.Int64Var(&cfg.Record.MaxSize, "record-max-size", cfg.Record.MaxSize, "bytes after which a new recording file is started")
+	fs.Var((*durationValue)(&cfg.Record.MaxDuration), "record-max-duration", "duration after which a new recording file is started")
+}
+
+// loadConfig builds the configuration from args, the file given by -config
+// and the environment. It returns the arguments left after the flags, and
+// printConfig is set by --print-config. extra, if not nil, registers flags
+// of the command, which are set from args and the environment too.
+func loadConfig(name string, args []string, extra func(*flag.FlagSet)) (cfg *Config, rest []string, printConfig bool, err error) {
+	cfg = new(Config)
+	*cfg = DefaultConfig()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML or TOML config file")
+	fs.BoolVar(&printConfig, "print-config", false, "print the configuration and exit")
+	cfg.flags(fs)
+	if extra != nil {
+		extra(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, false, err
+	}
+
+	// Flags were parsed into cfg only to learn the config file; they are
+	// applied again on top of the file and the environment.
+	set := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	*cfg = DefaultConfig()
+	if *path != "" {
+		if err := cfg.readFile(*path); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		value, ok := set[f.Name]
+		if !ok {
+			value, ok = os.LookupEnv(envName(f.Name))
+		}
+		if ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.Name, err))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, false, err
+	}
+	return cfg, fs.Args(), printConfig, nil
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func (cfg *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, cfg)
+	case ".toml":
+		return toml.Unmarshal(data, cfg)
+	}
+	return fmt.Errorf("unknown config file type %q", filepath.Ext(path))
+}
+
+// Validate reports every invalid setting.
+func (cfg *Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(cfg.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("listen: %w", err))
+	}
+	if cfg.FPS < 1 || cfg.FPS > 60 {
+		errs = append(errs, fmt.Errorf("fps: %d is not between 1 and 60", cfg.FPS))
+	}
+	if cfg.DPI < 1 {
+		errs = append(errs, fmt.Errorf("dpi: %d is not positive", cfg.DPI))
+	}
+	if (cfg.Width != 0 || cfg.Height != 0) && (cfg.Width < 1 || cfg.Height < 1) {
+		errs = append(errs, fmt.Errorf("screen size: %dx%d is not positive", cfg.Width, cfg.Height))
+	}
+	if cfg.Dongle.NightMode < 0 || cfg.Dongle.NightMode > 2 {
+		errs = append(errs, fmt.Errorf("dongle night mode: %d is not 0, 1 or 2", cfg.Dongle.NightMode))
+	}
+	if cfg.Dongle.HandDriveMode < 0 || cfg.Dongle.HandDriveMode > 1 {
+		errs = append(errs, fmt.Errorf("dongle hand drive mode: %d is not 0 or 1", cfg.Dongle.HandDriveMode))
+	}
+	if cfg.Dongle.ChargeMode < 0 || cfg.Dongle.ChargeMode > 1 {
+		errs = append(errs, fmt.Errorf("dongle charge mode: %d is not 0 or 1", cfg.Dongle.ChargeMode))
+	}
+	if cfg.Dongle.MediaDelay < 0 {
+		errs = append(errs, fmt.Errorf("dongle media delay: %d is negative", cfg.Dongle.MediaDelay))
+	}
+	if cfg.Dongle.MicType < 0 || cfg.Dongle.MicType > 1 {
+		errs = append(errs, fmt.Errorf("dongle mic type: %d is not 0 or 1", cfg.Dongle.MicType))
+	}
+	switch link.WifiBand(cfg.Dongle.WifiBand) {
+	case link.WifiBand24GHz:
+		if cfg.Dongle.WifiChannel != 0 && (cfg.Dongle.WifiChannel < 1 || cfg.Dongle.WifiChannel > 14) {
+			errs = append(errs, fmt.Errorf("dongle wifi channel: %d is not a 2.4GHz channel", cfg.Dongle.WifiChannel))
+		}
+	case link.WifiBand5GHz:
+		if cfg.Dongle.WifiChannel != 0 && (cfg.Dongle.WifiChannel < 36 || cfg.Dongle.WifiChannel > 165) {
+			errs = append(errs, fmt.Errorf("dongle wifi channel: %d is not a 5GHz channel", cfg.Dongle.WifiChannel))
+		}
+	case "":
+		// The firmware picks the band, so the channel may be of either.
+		if c := cfg.Dongle.WifiChannel; c != 0 && (c < 1 || c > 14) && (c < 36 || c > 165) {
+			errs = append(errs, fmt.Errorf("dongle wifi channel: %d is not a 2.4GHz or 5GHz channel", c))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("dongle wifi band: %q is not empty, 2.4GHz or 5GHz", cfg.Dongle.WifiBand))
+	}
+	if _, err := link.ParseWorkMode(cfg.Dongle.WorkMode); err != nil {
+		errs = append(errs, fmt.Errorf("dongle work mode: %q is not carplay or androidauto", cfg.Dongle.WorkMode))
+	}
+	if cfg.Dongle.AndroidAutoDPI < 0 {
+		errs = append(errs, fmt.Errorf("dongle android auto dpi: %d is negative", cfg.Dongle.AndroidAutoDPI))
+	}
+	if cfg.Navi.Width != 0 || cfg.Navi.Height != 0 {
+		if cfg.Navi.Width < 1 || cfg.Navi.Height < 1 {
+			errs = append(errs, fmt.Errorf("navi size: %dx%d is not positive", cfg.Navi.Width, cfg.Navi.Height))
+		}
+		if cfg.Navi.FPS < 1 || cfg.Navi.FPS > 60 {
+			errs = append(errs, fmt.Errorf("navi fps: %d is not between 1 and 60", cfg.Navi.FPS))
+		}
+	}
+	if (cfg.ICE.UDPPortMin == 0) != (cfg.ICE.UDPPortMax == 0) || cfg.ICE.UDPPortMax < cfg.ICE.UDPPortMin {
+		errs = append(errs, fmt.Errorf("ice udp ports: %d-%d is not a valid range", cfg.ICE.UDPPortMin, cfg.ICE.UDPPortMax))
+	}
+	for _, ip := range cfg.ICE.NAT1To1IPs {
+		if net.ParseIP(ip) == nil {
+			errs = append(errs, fmt.Errorf("ice nat 1:1 ips: %q is not an IP address", ip))
+		}
+	}
+	if _, err := cfg.Log.level(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Log.Format != "json" && cfg.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("log format: %q is not json or text", cfg.Log.Format))
+	}
+	if (cfg.TLS.Cert == "") != (cfg.TLS.Key == "") {
+		errs = append(errs, errors.New("tls: cert and key must be given together"))
+	}
+	if _, err := recorder.ParseFormat(cfg.Record.Format); err != nil {
+		errs = append(errs, fmt.Errorf("record format: %q: %w", cfg.Record.Format, err))
+	}
+	if cfg.Record.MaxSize < 0 || cfg.Record.MaxDuration < 0 {
+		errs = append(errs, errors.New("record: max size and duration must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// redacted replaces the secrets printed by Print.
+const redacted = "REDACTED"
+
+// Print writes cfg as YAML, with the tokens and the TURN credential redacted.
+func (cfg *Config) Print(w io.Writer) error {
+	printed := *cfg
+	for _, secret := range []*string{&printed.Auth.Token, &printed.Auth.ViewToken, &printed.ICE.Credential} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&printed); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func (c LogConfig) level() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return 0, fmt.Errorf("log level: %w", err)
+	}
+	return level, nil
+}
+
+// Logger returns the logger configured by c writing to w.
+func (c LogConfig) Logger(w io.Writer) *slog.Logger {
+	level, _ := c.level()
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+type int32Value struct{ p *int32 }
+
+func (v int32Value) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.FormatInt(int64(*v.p), 10)
+}
+
+func (v int32Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 0, 32)
+	*v.p = int32(n)
+	return err
+}
+
+// uint16Value accepts decimal and 0x prefixed hexadecimal values.
+type uint16Value struct{ p *uint16 }
+
+func (v uint16Value) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return fmt.Sprintf("%#04x", *v.p)
+}
+
+func (v uint16Value) Set(s string) error {
+	n, err := strconv.ParseUint(s, 0, 16)
+	*v.p = uint16(n)
+	return err
+}
+
+// listValue is a comma separated list.
+type listValue []string
+
+func (v *listValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+type durationValue Duration
+
+func (v *durationValue) String() string {
+	if v == nil {
+		return "0s"
+	}
+	return time.Duration(*v).String()
+}
+
+func (v *durationValue) Set(s string) error {
+	return (*Duration)(v).UnmarshalText([]byte(s))
+}
+
+// defaultScreenSize is the screen size used when none is set.
+var defaultScreenSize = link.ScreenSize{Width: 1280, Height: 720}
+
+// screenSize returns the screen size set, or defaultScreenSize.
+func (cfg *Config) screenSize() link.ScreenSize {
+	if cfg.Width == 0 && cfg.Height == 0 {
+		return defaultScreenSize
+	}
+	return link.ScreenSize{Width: cfg.Width, Height: cfg.Height}
+}
+
+func (cfg *Config) dongleConfig() link.DongleConfig {
+	workMode, _ := link.ParseWorkMode(cfg.Dongle.WorkMode)
+	return link.DongleConfig{
+		NightMode:      cfg.Dongle.NightMode,
+		HandDriveMode:  cfg.Dongle.HandDriveMode,
+		ChargeMode:     cfg.Dongle.ChargeMode,
+		BoxName:        cfg.Dongle.BoxName,
+		MediaDelay:     cfg.Dongle.MediaDelay,
+		MicType:        cfg.Dongle.MicType,
+		Wireless:       cfg.Dongle.Wireless,
+		WifiBand:       link.WifiBand(cfg.Dongle.WifiBand),
+		WifiChannel:    cfg.Dongle.WifiChannel,
+		WorkMode:       workMode,
+		AndroidAutoDPI: cfg.Dongle.AndroidAutoDPI,
+	}
+}
+
+// connect connects to the dongle, copying what it sends to the capture file if
+// one is set. The returned closer closes the capture file, and a failed write
+// to it calls stop with the error.
+func (cfg *Config) connect(ctx context.Context, stop context.CancelCauseFunc) (io.Reader, io.Writer, io.Closer, error) {
+	in, out, err := link.ConnectDevice(ctx, gousb.ID(cfg.Dongle.VendorID), gousb.ID(cfg.Dongle.ProductID))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg.Capture == "" {
+		return in, out, nopCloser{}, nil
+	}
+
+	captureFile, err := os.Create(cfg.Capture)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	capture := &captureReader{r: in, f: captureFile, stop: stop}
+	return capture, out, capture, nil
+}
+
+// newLink connects to the dongle and opens a link to it with the screen size
+// of cfg. The returned closer closes the capture file, as with connect.
+func (cfg *Config) newLink(ctx context.Context, stop context.CancelCauseFunc, logger link.Logger) (*link.Link, io.Closer, error) {
+	in, out, capture, err := cfg.connect(ctx, stop)
+	if err != nil {
+		return nil, nil, err
+	}
+	lnk, err := link.New(
+		link.WithContext(ctx),
+		link.WithDPI(cfg.DPI),
+		link.WithFPS(cfg.FPS),
+		link.WithScreenSize(cfg.screenSize()),
+		link.WithDongleConfig(cfg.dongleConfig()),
+		link.WithReader(in),
+		link.WithWriter(out),
+		link.WithLogger(logger),
+	)
+	if err != nil {
+		capture.Close()
+		return nil, nil, err
+	}
+	return lnk, capture, nil
+}
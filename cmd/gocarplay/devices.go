@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/gousb"
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// devices lists the attached dongles: the known models and the one configured.
+func devices(ctx context.Context, cfg *Config, args []string) error {
+	ids := append([]link.USBID(nil), link.KnownDevices...)
+	configured := link.USBID{Vendor: gousb.ID(cfg.Dongle.VendorID), Product: gousb.ID(cfg.Dongle.ProductID)}
+	found := false
+	for _, id := range ids {
+		found = found || id == configured
+	}
+	if !found {
+		ids = append(ids, configured)
+	}
+
+	devs, err := link.Devices(ids...)
+	if err != nil {
+		return err
+	}
+	if len(devs) == 0 {
+		fmt.Fprintln(os.Stderr, "no dongles found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUS\tADDRESS\tID\tMANUFACTURER\tPRODUCT\tSERIAL")
+	for _, d := range devs {
+		fmt.Fprintf(w, "%03d\t%03d\t%s:%s\t%s\t%s\t%s\n", d.Bus, d.Address, d.ID.Vendor, d.ID.Product, d.Manufacturer, d.Product, d.Serial)
+	}
+	return w.Flush()
+}
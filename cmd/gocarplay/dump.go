@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// dumpOptions are the flags of the dump command.
+var dumpOptions struct {
+	json  bool
+	media bool
+	types listValue
+}
+
+func dumpFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&dumpOptions.json, "json", false, "print one JSON object per frame")
+	fs.BoolVar(&dumpOptions.media, "media", false, "print video and audio frames too, not only their stats")
+	fs.Var(&dumpOptions.types, "type", "comma separated message names or IDs to print, such as CarPlay,0x19")
+}
+
+// dump decodes what the dongle sends, read from the capture file given in
+// args or live from the dongle, and prints every frame and then the stats of
+// the video and audio frames.
+func dump(ctx context.Context, cfg *Config, args []string) error {
+	var src io.Reader
+	switch len(args) {
+	case 0:
+		var stop context.CancelCauseFunc
+		ctx, stop = context.WithCancelCause(ctx)
+		defer stop(nil)
+		in, out, capture, err := cfg.connect(ctx, stop)
+		if err != nil {
+			return err
+		}
+		defer capture.Close()
+		// The link reads and answers the dongle so that the handshakes run
+		// and a wireless phone connects; the frames it reads are teed here.
+		pr, pw := io.Pipe()
+		defer pw.Close()
+		lnk, err := link.New(
+			link.WithContext(ctx),
+			link.WithDPI(cfg.DPI),
+			link.WithFPS(cfg.FPS),
+			link.WithDongleConfig(cfg.dongleConfig()),
+			link.WithReader(io.TeeReader(in, pw)),
+			link.WithWriter(out),
+			link.WithLogger(cfg.Log.Logger(os.Stderr)),
+		)
+		if err != nil {
+			return err
+		}
+		if err := lnk.SetScreenSize(cfg.screenSize()); err != nil {
+			return err
+		}
+		go lnk.Communicate(func(data any) {})
+		src = pr
+	case 1:
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		src = f
+	default:
+		return errors.New("dump: expected at most one capture FILE")
+	}
+
+	d := newDumper(os.Stdout, dumpOptions.json, dumpOptions.media, dumpOptions.types)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			hdr, payload, err := readFrame(src)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if err := d.frame(hdr, payload); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case <-ctx.Done():
+	}
+	if serr := d.summary(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// readFrame reads and decodes the next message from r.
+func readFrame(r io.Reader) (protocol.Header, any, error) {
+	var hdr protocol.Header
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return hdr, nil, err
+	}
+	if err := protocol.Unmarshal(buf, &hdr); err != nil {
+		return hdr, nil, err
+	}
+
+	buf = make([]byte, hdr.Length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return hdr, nil, io.ErrUnexpectedEOF
+	}
+	// Payloads that fail to decode are dumped as they are.
+	payload := protocol.GetPayloadByHeader(hdr)
+	if err := protocol.Unmarshal(buf, payload); err != nil {
+		return hdr, &protocol.Unknown{ID: hdr.Type, Data: buf}, nil
+	}
+	if media, ok := payload.(*protocol.MediaData); ok {
+		if decoded, err := media.Decode(); err == nil {
+			return hdr, decoded, nil
+		}
+	}
+	return hdr, payload, nil
+}
+
+// messageName is the name of the type of payload, such as "VideoData".
+func messageName(payload any) string {
+	return reflect.TypeOf(payload).Elem().Name()
+}
+
+type dumper struct {
+	w     io.Writer
+	json  bool
+	media bool
+	names map[string]bool
+	ids   map[uint32]bool
+
+	start time.Time
+	count int
+	video videoStats
+	audio audioStats
+}
+
+func newDumper(w io.Writer, asJSON, media bool, types []string) *dumper {
+	d := &dumper{
+		w:     w,
+		json:  asJSON,
+		media: media,
+		start: time.Now(),
+		video: videoStats{Sizes: map[string]int{}},
+		audio: audioStats{Formats: map[string]int{}, Commands: map[string]int{}},
+	}
+	for _, t := range types {
+		if id, err := strconv.ParseUint(t, 0, 32); err == nil {
+			if d.ids == nil {
+				d.ids = map[uint32]bool{}
+			}
+			d.ids[uint32(id)] = true
+			continue
+		}
+		if d.names == nil {
+			d.names = map[string]bool{}
+		}
+		d.names[strings.ToLower(t)] = true
+	}
+	return d
+}
+
+// dumpRecord is a frame printed with -json.
+type dumpRecord struct {
+	Index   int           `json:"index"`
+	Elapsed time.Duration `json:"elapsed"`
+	Type    uint32        `json:"type"`
+	Name    string        `json:"name"`
+	Length  uint32        `json:"length"`
+	Payload any           `json:"payload,omitempty"`
+	Hex     string        `json:"hex,omitempty"`
+}
+
+func (d *dumper) frame(hdr protocol.Header, payload any) error {
+	d.count++
+	name := messageName(payload)
+	switch payload := payload.(type) {
+	case *protocol.VideoData:
+		d.video.add(payload)
+	case *protocol.AudioData:
+		d.audio.add(payload)
+	}
+
+	if !d.show(hdr.Type, name, payload) {
+		return nil
+	}
+
+	rec := dumpRecord{
+		Index:   d.count,
+		Elapsed: time.Since(d.start),
+		Type:    hdr.Type,
+		Name:    name,
+		Length:  hdr.Length,
+		Payload: payload,
+	}
+	var text string
+	switch payload := payload.(type) {
+	case *protocol.VideoData:
+		rec.Payload = struct {
+			Width, Height, Flags, Length int32
+		}{payload.Width, payload.Height, payload.Flags, payload.Length}
+		text = fmt.Sprintf("%dx%d flags=%d length=%d", payload.Width, payload.Height, payload.Flags, payload.Length)
+	case *protocol.NaviVideoData:
+		rec.Payload = struct {
+			Width, Height, Flags, Length int32
+		}{payload.Width, payload.Height, payload.Flags, payload.Length}
+		text = fmt.Sprintf("%dx%d flags=%d length=%d", payload.Width, payload.Height, payload.Flags, payload.Length)
+	case *protocol.AudioData:
+		rec.Payload = struct {
+			DecodeType     protocol.DecodeType
+			Volume         float32
+			AudioType      int32
+			Command        string
+			VolumeDuration int32
+			Length         int
+		}{payload.DecodeType, payload.Volume, payload.AudioType, payload.Command.GoString(), payload.VolumeDuration, len(payload.Data)}
+		text = fmt.Sprintf("decode=%d volume=%g type=%d command=%#v duration=%d length=%d", payload.DecodeType, payload.Volume, payload.AudioType, payload.Command, payload.VolumeDuration, len(payload.Data))
+	case *protocol.CarPlay:
+		rec.Payload = struct{ Command string }{payload.Command.GoString()}
+		text = fmt.Sprintf("%#v", payload.Command)
+	case *protocol.AlbumArt:
+		rec.Payload = struct{ ContentType string }{http.DetectContentType(payload.Data)}
+		text = fmt.Sprintf("%s length=%d", http.DetectContentType(payload.Data), len(payload.Data))
+	case *protocol.BoxSettings:
+		rec.Payload = json.RawMessage(bytes.TrimRight(payload.Raw, "\x00"))
+		text = string(bytes.TrimRight(payload.Raw, "\x00"))
+	case *protocol.Unknown:
+		rec.Payload = nil
+		rec.Hex = hex.EncodeToString(payload.Data)
+		text = "\n" + strings.TrimSuffix(hex.Dump(payload.Data), "\n")
+	default:
+		text = strings.TrimPrefix(fmt.Sprintf("%#v", payload), "&protocol."+name)
+	}
+
+	if d.json {
+		return json.NewEncoder(d.w).Encode(&rec)
+	}
+	if name == "Unknown" {
+		name = fmt.Sprintf("Unknown(0x%02x)", hdr.Type)
+	}
+	_, err := fmt.Fprintf(d.w, "%6d %10s %-20s %s\n", rec.Index, rec.Elapsed.Truncate(time.Millisecond), name, text)
+	return err
+}
+
+// show reports whether a frame is printed, rather than only counted.
+func (d *dumper) show(id uint32, name string, payload any) bool {
+	if d.names != nil || d.ids != nil {
+		return d.ids[id] || d.names[strings.ToLower(name)]
+	}
+	switch payload.(type) {
+	case *protocol.VideoData, *protocol.NaviVideoData, *protocol.AudioData:
+		return d.media
+	}
+	return true
+}
+
+func (d *dumper) summary() error {
+	stats := struct {
+		Frames int        `json:"frames"`
+		Video  videoStats `json:"video"`
+		Audio  audioStats `json:"audio"`
+	}{d.count, d.video, d.audio}
+
+	if d.json {
+		return json.NewEncoder(d.w).Encode(map[string]any{"stats": stats})
+	}
+	fmt.Fprintf(d.w, "\n%d frames\n", stats.Frames)
+	fmt.Fprintf(d.w, "video: %d frames, %d bytes, %.1f fps, sizes %s\n", d.video.Frames, d.video.Bytes, d.video.FPS(), counts(d.video.Sizes))
+	_, err := fmt.Fprintf(d.w, "audio: %d packets, %d bytes, formats %s, commands %s\n", d.audio.Packets, d.audio.Bytes, counts(d.audio.Formats), counts(d.audio.Commands))
+	return err
+}
+
+type videoStats struct {
+	Frames int            `json:"frames"`
+	Bytes  int            `json:"bytes"`
+	Sizes  map[string]int `json:"sizes"`
+	first  time.Time
+	last   time.Time
+}
+
+func (s *videoStats) add(data *protocol.VideoData) {
+	now := time.Now()
+	if s.Frames == 0 {
+		s.first = now
+	}
+	s.last = now
+	s.Frames++
+	s.Bytes += len(data.Data)
+	s.Sizes[fmt.Sprintf("%dx%d", data.Width, data.Height)]++
+}
+
+// FPS is the rate the frames were read at, which is only meaningful live.
+func (s *videoStats) FPS() float64 {
+	elapsed := s.last.Sub(s.first).Seconds()
+	if s.Frames < 2 || elapsed == 0 {
+		return 0
+	}
+	return float64(s.Frames-1) / elapsed
+}
+
+type audioStats struct {
+	Packets  int            `json:"packets"`
+	Bytes    int            `json:"bytes"`
+	Formats  map[string]int `json:"formats"`
+	Commands map[string]int `json:"commands"`
+}
+
+func (s *audioStats) add(data *protocol.AudioData) {
+	s.Packets++
+	if len(data.Data) == 0 {
+		if data.Command != 0 {
+			s.Commands[data.Command.GoString()]++
+		}
+		return
+	}
+	s.Bytes += len(data.Data)
+	f := protocol.AudioDecodeTypes[data.DecodeType]
+	s.Formats[fmt.Sprintf("%dHz/%dch", f.Frequency, f.Channel)]++
+}
+
+// counts formats a count of each key, such as "1280x720:250 800x480:10".
+func counts(m map[string]int) string {
+	if len(m) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s:%d", k, m[k])
+	}
+	return strings.Join(parts, " ")
+}
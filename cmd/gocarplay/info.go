@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// infoTimeout is how long info waits for the dongle to report itself.
+const infoTimeout = 10 * time.Second
+
+// info prints what the dongle reports about itself and the paired phones.
+func info(ctx context.Context, cfg *Config, args []string) error {
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	ctx, cancel := context.WithTimeout(ctx, infoTimeout)
+	defer cancel()
+
+	lnk, capture, err := cfg.newLink(ctx, stop, cfg.Log.Logger(os.Stderr))
+	if err != nil {
+		return err
+	}
+	defer capture.Close()
+	if err := lnk.SetScreenSize(cfg.screenSize()); err != nil {
+		return err
+	}
+
+	fields := []string{"Software version", "Bluetooth address", "Bluetooth PIN", "Bluetooth name", "Wi-Fi name", "Paired phones"}
+	values := make(chan [2]string)
+	go lnk.Communicate(func(data any) {
+		var field, value string
+		switch data := data.(type) {
+		case *protocol.SoftwareVersion:
+			field, value = fields[0], string(data.Version)
+		case *protocol.BluetoothAddress:
+			field, value = fields[1], string(data.Address)
+		case *protocol.BluetoothPIN:
+			field, value = fields[2], string(data.Address)
+		case *protocol.BluetoothDeviceName:
+			field, value = fields[3], string(data.Data)
+		case *protocol.WifiDeviceName:
+			field, value = fields[4], string(data.Data)
+		case *protocol.BluetoothPairedList:
+			field, value = fields[5], string(data.Data)
+		default:
+			return
+		}
+		select {
+		case values <- [2]string{field, strings.TrimRight(value, "\x00")}:
+		case <-ctx.Done():
+		}
+	})
+
+	got := map[string]string{}
+	for len(got) < len(fields) && ctx.Err() == nil {
+		select {
+		case v := <-values:
+			got[v[0]] = v[1]
+		case <-ctx.Done():
+		}
+	}
+	if len(got) == 0 {
+		return errors.New("no reply from the dongle")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, field := range fields {
+		value, ok := got[field]
+		if !ok {
+			value = "-"
+		}
+		fmt.Fprintf(w, "%s:\t%s\n", field, strings.ReplaceAll(value, "\n", "\n\t"))
+	}
+	if caps, ok := lnk.Capabilities(); ok {
+		version, _ := lnk.SoftwareVersion()
+		fmt.Fprintf(w, "Parsed version:\t%s\n", version)
+		fmt.Fprintf(w, "Capabilities:\t%s\n", capabilityNames(caps))
+	}
+	return w.Flush()
+}
+
+// capabilityNames lists the names of the supported capabilities.
+func capabilityNames(caps link.Capabilities) string {
+	var names []string
+	for _, c := range []struct {
+		name string
+		ok   bool
+	}{
+		{"multi-touch", caps.MultiTouch},
+		{"box settings", caps.BoxSettings},
+		{"wireless CarPlay", caps.WirelessCarPlay},
+		{"Android Auto", caps.AndroidAuto},
+		{"navigation video", caps.NaviVideo},
+	} {
+		if c.ok {
+			names = append(names, c.name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ", ")
+}
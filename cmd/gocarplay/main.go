@@ -2,19 +2,67 @@ package main
 
 import (
 	"context"
-	"io"
-	"log"
-	"log/slog"
-	"net/http"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
-
-	"github.com/mzyy94/gocarplay/internal/dist"
-	"github.com/mzyy94/gocarplay/internal/server"
-	"github.com/mzyy94/gocarplay/link"
+	"strings"
 )
 
+type command struct {
+	usage string
+	run   func(ctx context.Context, cfg *Config, args []string) error
+	// flags registers the flags of the command besides the configuration.
+	flags func(fs *flag.FlagSet)
+}
+
+var commands = map[string]command{
+	"devices": {"list attached dongles", devices, nil},
+	"info":    {"print the dongle's identity and paired phones", info, nil},
+	"serve":   {"serve the web UI (default)", serve, nil},
+	"record":  {"capture what the dongle sends to FILE without serving", record, nil},
+	"replay":  {"serve a capture FILE through the web UI", replay, nil},
+	"dump":    {"decode a capture FILE, or the live dongle, frame by frame", dump, dumpFlags},
+}
+
+var commandOrder = []string{"devices", "info", "serve", "record", "replay", "dump"}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [command] [flags] [args]\n\ncommands:\n", os.Args[0])
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun %s <command> -h for its flags\n", os.Args[0])
+}
+
 func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, rest, printConfig, err := loadConfig(os.Args[0]+" "+name, args, cmd.flags)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -34,47 +82,9 @@ func main() {
 		}
 	}()
 
-	logHandler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{})
-	logr := slog.New(logHandler)
-
-	connectHander, err := server.NewServer(
-		server.WithLogger(logr),
-		server.WithContext(ctx),
-		server.WithConnector(server.ConnectFunc(func(ctx context.Context) (io.Reader, io.Writer, error) {
-			in, out, err := link.Connect(ctx)
-			if err != nil {
-				return nil, nil, err
-			}
-
-			testFile, err := os.Create("./test_file.txt")
-			if err != nil {
-				return nil, nil, err
-			}
-			in2 := io.MultiReader(in, testFile)
-
-			return in2, out, nil
-		})),
-	)
-	if err != nil {
-		logr.Error("new server", "error", err.Error())
+	if err := cmd.run(ctx, cfg, rest); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		cancel()
 		os.Exit(1)
 	}
-
-	mux := http.NewServeMux()
-	mux.Handle("/connect", connectHander)
-	mux.Handle("/", dist.UIHandler)
-
-	srvr := http.Server{
-		Addr:    ":8001",
-		Handler: mux,
-	}
-
-	go func() {
-		<-ctx.Done()
-		if err := srvr.Shutdown(ctx); err != nil {
-			slog.Error("shutdown", "error", err.Error())
-		}
-	}()
-
-	log.Fatal(srvr.ListenAndServe())
 }
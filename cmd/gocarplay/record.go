@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// record captures what the dongle sends to the file given in args, without
+// serving, until interrupted. The capture can be served again with replay.
+func record(ctx context.Context, cfg *Config, args []string) (err error) {
+	if len(args) != 1 {
+		return errors.New("record: expected one capture FILE")
+	}
+	cfg.Capture = args[0]
+
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	logr := cfg.Log.Logger(os.Stderr)
+	lnk, capture, err := cfg.newLink(ctx, stop, logr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := capture.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if err := lnk.SetScreenSize(cfg.screenSize()); err != nil {
+		return err
+	}
+	go lnk.Communicate(func(data any) {})
+
+	logr.Info("recording", "file", cfg.Capture)
+	<-ctx.Done()
+	return stopCause(ctx)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mzyy94/gocarplay/internal/server"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+const headerSize = 16
+
+// replay serves the capture file given in args as if it came from the dongle.
+func replay(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("replay: expected one capture FILE")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := &pacedReader{
+		src:   f,
+		size:  info.Size(),
+		frame: time.Second / time.Duration(cfg.FPS),
+	}
+	if _, ok, err := r.next(make([]byte, headerSize)); err != nil {
+		return err
+	} else if !ok {
+		return errNoFrame
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return serveConnector(ctx, cfg, server.ConnectFunc(func(ctx context.Context) (io.Reader, io.Writer, error) {
+		return r, io.Discard, nil
+	}))
+}
+
+var errNoFrame = errors.New("replay: no complete frame in capture")
+
+// videoType is the ID of the video frames the replay is paced by.
+var videoType = (&protocol.VideoData{}).Type()
+
+// pacedReader reads a capture at the frame rate of the config, as captures do
+// not record when frames arrived, starting over at its end or at a frame cut
+// short when the recording stopped. Each read is either a message header or
+// its payload, as link.ReceiveMessage expects.
+type pacedReader struct {
+	src   io.ReadSeeker
+	size  int64
+	frame time.Duration
+	// left is the length of the payload not yet read of the current message.
+	left int
+}
+
+func (r *pacedReader) Read(p []byte) (int, error) {
+	if r.left > 0 {
+		n, err := io.ReadFull(r.src, p)
+		r.left -= n
+		return n, err
+	}
+
+	hdr, ok, err := r.next(p)
+	if err == nil && !ok {
+		if _, err = r.src.Seek(0, io.SeekStart); err == nil {
+			hdr, ok, err = r.next(p)
+		}
+		if err == nil && !ok {
+			err = errNoFrame
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	r.left = int(hdr.Length)
+	if hdr.Type == videoType {
+		time.Sleep(r.frame)
+	}
+	return len(p), nil
+}
+
+// next reads the header of the next message into p. It reports false at the
+// end of the capture and when the payload is cut short.
+func (r *pacedReader) next(p []byte) (protocol.Header, bool, error) {
+	var hdr protocol.Header
+	if len(p) != headerSize {
+		return hdr, false, fmt.Errorf("replay: read of %d bytes for a header", len(p))
+	}
+	if _, err := io.ReadFull(r.src, p); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return hdr, false, nil
+	} else if err != nil {
+		return hdr, false, err
+	}
+	if err := protocol.Unmarshal(p, &hdr); err != nil {
+		return hdr, false, err
+	}
+	pos, err := r.src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return hdr, false, err
+	}
+	return hdr, pos+int64(hdr.Length) <= r.size, nil
+}
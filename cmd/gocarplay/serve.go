@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mzyy94/gocarplay/internal/certs"
+	"github.com/mzyy94/gocarplay/internal/dist"
+	"github.com/mzyy94/gocarplay/internal/server"
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/recorder"
+	"github.com/pion/webrtc/v3"
+)
+
+// serve serves the web UI for the dongle, until interrupted or a write to the
+// capture file fails.
+func serve(ctx context.Context, cfg *Config, args []string) error {
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	err := serveConnector(ctx, cfg, server.ConnectFunc(func(ctx context.Context) (io.Reader, io.Writer, error) {
+		in, out, capture, err := cfg.connect(ctx, stop)
+		if err != nil {
+			return nil, nil, err
+		}
+		context.AfterFunc(ctx, func() { capture.Close() })
+		return in, out, nil
+	}))
+	if err != nil {
+		return err
+	}
+	return stopCause(ctx)
+}
+
+// serveConnector serves the web UI for the dongle connected by connector.
+func serveConnector(ctx context.Context, cfg *Config, connector server.Connector) error {
+	logr := cfg.Log.Logger(os.Stdout)
+
+	format, _ := recorder.ParseFormat(cfg.Record.Format)
+	rec, err := recorder.New(
+		recorder.WithDir(cfg.Record.Dir),
+		recorder.WithFormat(format),
+		recorder.WithFPS(cfg.FPS),
+		recorder.WithMaxSize(cfg.Record.MaxSize),
+		recorder.WithMaxDuration(time.Duration(cfg.Record.MaxDuration)),
+		recorder.WithLogger(logr),
+	)
+	if err != nil {
+		return err
+	}
+	defer rec.Stop()
+
+	var iceServers []webrtc.ICEServer
+	for _, url := range cfg.ICE.Servers {
+		iceServers = append(iceServers, webrtc.ICEServer{
+			URLs:       []string{url},
+			Username:   cfg.ICE.Username,
+			Credential: cfg.ICE.Credential,
+		})
+	}
+
+	opts := []server.Option{
+		server.WithLogger(logr),
+		server.WithContext(ctx),
+		server.WithFPS(cfg.FPS),
+		server.WithDPI(cfg.DPI),
+		server.WithDongleConfig(cfg.dongleConfig()),
+		server.WithRecorder(rec),
+		server.WithICEServers(iceServers...),
+		server.WithNAT1To1IPs(cfg.ICE.NAT1To1IPs...),
+		server.WithICELite(cfg.ICE.Lite),
+		server.WithConnector(connector),
+	}
+	// An explicit screen size lets WHEP players start the dongle headless.
+	if cfg.Width != 0 {
+		opts = append(opts, server.WithScreenSize(cfg.screenSize()))
+	}
+	if cfg.Navi.Width != 0 {
+		opts = append(opts, server.WithNaviVideo(link.ScreenSize{Width: cfg.Navi.Width, Height: cfg.Navi.Height}, cfg.Navi.FPS))
+	}
+	if cfg.ICE.UDPPortMin != 0 {
+		opts = append(opts, server.WithUDPPortRange(cfg.ICE.UDPPortMin, cfg.ICE.UDPPortMax))
+	}
+
+	// Clients must present one of these tokens, or a client certificate, when any is set.
+	var auths []server.Authenticator
+	tokens := map[string]server.Role{}
+	if cfg.Auth.ViewToken != "" {
+		tokens[cfg.Auth.ViewToken] = server.RoleView
+	}
+	if cfg.Auth.Token != "" {
+		tokens[cfg.Auth.Token] = server.RoleControl
+	}
+	if len(tokens) > 0 {
+		auths = append(auths, server.TokenAuth(tokens))
+	}
+	if cfg.TLS.Enabled && cfg.TLS.ClientCA != "" {
+		auths = append(auths, server.ClientCertAuth(nil))
+	}
+	if len(auths) > 0 {
+		opts = append(opts, server.WithAuthenticator(server.AnyAuth(auths...)))
+	}
+
+	connectHander, err := server.NewServer(opts...)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/config", connectHander)
+	mux.Handle("/connect", connectHander)
+	mux.Handle("/connect/", connectHander)
+	mux.Handle("/ws", connectHander)
+	mux.Handle("/whep", connectHander)
+	mux.Handle("/whep/", connectHander)
+	mux.Handle("/record", connectHander)
+	mux.Handle("/record/", connectHander)
+	mux.Handle("/nowplaying", connectHander)
+	mux.Handle("/nowplaying/", connectHander)
+	mux.Handle("/call", connectHander)
+	mux.Handle("/pairing", connectHander)
+	mux.Handle("/pairing/", connectHander)
+	mux.Handle("/", dist.UIHandler)
+
+	srvr := http.Server{
+		Addr:    cfg.Listen,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := srvr.Shutdown(context.Background()); err != nil {
+			slog.Error("shutdown", "error", err.Error())
+		}
+	}()
+
+	if !cfg.TLS.Enabled {
+		return ignoreServerClosed(srvr.ListenAndServe())
+	}
+
+	var cert *tls.Certificate
+	if cfg.TLS.Cert != "" {
+		cert, err = certs.Load(cfg.TLS.Cert, cfg.TLS.Key)
+	} else {
+		cert, err = certs.Bootstrap(cfg.TLS.Dir, certs.LocalHosts())
+	}
+	if err != nil {
+		return err
+	}
+	srvr.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*cert}}
+
+	if cfg.TLS.ClientCA != "" {
+		caPEM, err := os.ReadFile(cfg.TLS.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return certs.ErrNoPEM
+		}
+		srvr.TLSConfig.ClientCAs = pool
+		srvr.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	if cfg.TLS.HTTPRedirect != "" {
+		go func() {
+			logr.Error("http redirect", "error", http.ListenAndServe(cfg.TLS.HTTPRedirect, redirectHandler(srvr.Addr)).Error())
+		}()
+	}
+
+	return ignoreServerClosed(srvr.ListenAndServeTLS("", ""))
+}
+
+// ignoreServerClosed returns err unless it reports a graceful shutdown.
+func ignoreServerClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// redirectHandler redirects requests to the same host and path on the HTTPS
+// server listening on httpsAddr.
+func redirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -4,9 +4,12 @@ go 1.22
 
 require (
 	github.com/google/gousb v1.1.1
+	github.com/gorilla/websocket v1.5.3
 	github.com/lunixbochs/struc v0.0.0-20200707160740-784aaebc1d40
+	github.com/pelletier/go-toml/v2 v2.2.2
 	github.com/pion/webrtc/v3 v3.2.37
 	golang.org/x/sync v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -32,5 +35,4 @@ require (
 	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/net v0.22.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,124 +1,346 @@
 const video = document.querySelector("video");
-const pc = new RTCPeerConnection({
-  iceServers: [
-    {
-      urls: "stun:stun.l.google.com:19302",
-    },
-  ],
+const canvas = document.querySelector("canvas");
+
+// token is passed on to the server when the page is opened with ?token=.
+const token = new URLSearchParams(location.search).get("token");
+const withToken = (url) => {
+  if (!token) {
+    return url;
+  }
+  const u = new URL(url, location.href);
+  u.searchParams.set("token", token);
+  return u.toString();
+};
+
+const screenSize = () => ({
+  width: (innerWidth * devicePixelRatio) | 0,
+  height: (innerHeight * devicePixelRatio) | 0,
 });
 
-pc.ontrack = (event) => {
-  if (video.srcObject == null) {
-    video.srcObject = event.streams[0];
-  } else {
-    video.srcObject.addTrack(event.track);
+const audioCtx = new (window.AudioContext || window.webkitAudioContext)();
+
+// playAudio plays a packet of little endian uint16 sample rate and channel
+// count followed by 16 bit PCM samples.
+const playAudio = (buffer) => {
+  const dv = new DataView(buffer.slice(0, 4));
+  const data = new Float32Array(new Int16Array(buffer.slice(4))).map(
+    (d) => d / 32768
+  );
+  const sampleRate = dv.getUint16(0, true);
+  const channels = dv.getUint16(2, true);
+  const audioBuffer = audioCtx.createBuffer(
+    channels,
+    data.length / channels,
+    sampleRate
+  );
+
+  for (let ch = 0; ch < channels; ++ch) {
+    audioBuffer
+      .getChannelData(ch)
+      .set(data.filter((_, i) => i % channels == ch));
   }
+
+  const src = audioCtx.createBufferSource();
+  src.buffer = audioBuffer;
+  src.connect(audioCtx.destination);
+  src.start();
 };
 
-const startData = pc.createDataChannel("start");
-startData.onopen = () => startData.send(
-  JSON.stringify({
-    width: (innerWidth * devicePixelRatio) | 0,
-    height: (innerHeight * devicePixelRatio) | 0,
-  })
-);
+// attachTouch forwards pointer events on el as touches through send.
+const attachTouch = (el, send) => {
+  let pointerdown = false;
+  const sendTouchEvent = ({ type, offsetX, offsetY }) => {
+    let action = 16;
+    if (type == "pointerdown") {
+      action = 14;
+      pointerdown = true;
+    } else if (pointerdown) {
+      switch (type) {
+        case "pointermove":
+          action = 15;
+          break;
+        case "pointerup":
+        case "pointercancel":
+        case "pointerout":
+          pointerdown = false;
+          action = 16;
+          break;
+      }
+    } else {
+      return;
+    }
+    send({
+      x: (offsetX * devicePixelRatio) | 0,
+      y: (offsetY * devicePixelRatio) | 0,
+      action,
+    });
+  };
 
-pc.oniceconnectionstatechange = () => {
-  console.log("connection:", pc.iceConnectionState);
+  el.addEventListener("pointerdown", sendTouchEvent);
+  el.addEventListener("pointermove", sendTouchEvent);
+  el.addEventListener("pointerup", sendTouchEvent);
+  el.addEventListener("pointercancel", sendTouchEvent);
+  el.addEventListener("pointerout", sendTouchEvent);
 };
 
-pc.onicecandidate = (event) => {
-  console.log("ice candidate", event)
-  if (event.candidate == null) {
-    fetch("/connect", {
-      method: "POST",
-      body: JSON.stringify(pc.localDescription),
-    })
-      .then((res) => Promise.all([res.json(), res.ok]))
-      .then(([answer, ok]) => {
-        if (!ok) {
-          return Promise.reject(answer);
-        }
-        try {
-          pc.setRemoteDescription(new RTCSessionDescription(answer));
-        } catch (e) {
-          Promise.reject(e);
-        }
-      })
-      .catch(console.error);
-  }
+// keys maps keyboard keys to the head unit keys known by the server.
+const keys = {
+  Escape: "back",
+  Backspace: "back",
+  Home: "home",
+  ArrowLeft: "left",
+  ArrowRight: "right",
+  ArrowUp: "up",
+  ArrowDown: "down",
+  Enter: "select",
+  MediaPlayPause: "play",
+  MediaTrackNext: "next",
+  MediaTrackPrevious: "prev",
+  VoiceDial: "voice",
+};
+
+// attachKeys forwards keyboard keys through send. The server maps them to the
+// commands of the connected phone, CarPlay or Android Auto. It returns a
+// function removing the listeners.
+const attachKeys = (send) => {
+  const sendKeyEvent = (event) => {
+    const name = keys[event.key];
+    if (name == null || event.repeat) {
+      return;
+    }
+    event.preventDefault();
+    send({ name, up: event.type == "keyup" });
+  };
+  addEventListener("keydown", sendKeyEvent);
+  addEventListener("keyup", sendKeyEvent);
+  return () => {
+    removeEventListener("keydown", sendKeyEvent);
+    removeEventListener("keyup", sendKeyEvent);
+  };
 };
 
-pc.addTransceiver("video", { direction: "recvonly" });
+// watchCall shows an overlay while the phone rings or is on a call. The call
+// audio is played through audioCtx, which browsers may have suspended until now.
+const watchCall = () => {
+  const overlay = document.getElementById("call");
+  const labels = { ringing: "Incoming call", active: "On call" };
+  const events = new EventSource(withToken("/call"));
+  events.onmessage = (e) => {
+    const { state } = JSON.parse(e.data);
+    overlay.textContent = labels[state] || "";
+    overlay.hidden = !labels[state];
+    if (state == "active") {
+      audioCtx.resume().catch(console.error);
+    }
+  };
+};
+watchCall();
 
-const audioCtx = new (window.AudioContext || window.webkitAudioContext)();
+// attachSiri sends the voice key through send while the Siri button is held
+// down, for push-to-talk. A tap starts Siri, which then listens by itself.
+// It returns a function removing the listeners.
+const attachSiri = (send) => {
+  const button = document.getElementById("siri");
+  button.hidden = false;
+  const press = (up) => (event) => {
+    event.preventDefault();
+    send({ name: "voice", up });
+  };
+  const down = press(false);
+  const up = press(true);
+  button.addEventListener("pointerdown", down);
+  button.addEventListener("pointerup", up);
+  button.addEventListener("pointercancel", up);
+  return () => {
+    button.removeEventListener("pointerdown", down);
+    button.removeEventListener("pointerup", up);
+    button.removeEventListener("pointercancel", up);
+  };
+};
+
+// micSampleRate is the rate of the 16 bit mono PCM the phone expects.
+const micSampleRate = 16000;
 
-pc.ondatachannel = ({ channel: dc }) => {
-  if (dc.label == "audio") {
-    dc.onmessage = (e) => {
-      const dv = new DataView(e.data.slice(0, 4));
-      const data = new Float32Array(new Int16Array(e.data.slice(4))).map(
-        (d) => d / 32768
-      );
-      const sampleRate = dv.getUint16(0, true);
-      const channels = dv.getUint16(2, true);
-      const audioBuffer = audioCtx.createBuffer(
-        channels,
-        data.length / channels,
-        sampleRate
-      );
-
-      for (let ch = 0; ch < channels; ++ch) {
-        audioBuffer
-          .getChannelData(ch)
-          .set(data.filter((_, i) => i % channels == ch));
+// startMicrophone records the microphone and passes its samples to send as
+// little endian 16 bit PCM, until the returned function is called.
+const startMicrophone = (send) => {
+  let stop = null;
+  let stopped = false;
+  navigator.mediaDevices
+    .getUserMedia({ audio: { channelCount: 1, echoCancellation: true } })
+    .then((stream) => {
+      const ctx = new AudioContext({ sampleRate: micSampleRate });
+      const source = ctx.createMediaStreamSource(stream);
+      const processor = ctx.createScriptProcessor(2048, 1, 1);
+      processor.onaudioprocess = ({ inputBuffer }) => {
+        const samples = inputBuffer.getChannelData(0);
+        const pcm = new Int16Array(samples.length);
+        samples.forEach((sample, i) => {
+          pcm[i] = Math.max(-1, Math.min(1, sample)) * 32767;
+        });
+        send(pcm.buffer);
+      };
+      source.connect(processor);
+      processor.connect(ctx.destination);
+      stop = () => {
+        processor.disconnect();
+        source.disconnect();
+        stream.getTracks().forEach((track) => track.stop());
+        ctx.close();
+      };
+      if (stopped) {
+        stop();
       }
+    })
+    .catch((e) => console.error("microphone:", e));
+  return () => {
+    stopped = true;
+    if (stop) {
+      stop();
+    }
+  };
+};
 
-      const src = audioCtx.createBufferSource();
-      src.buffer = audioBuffer;
-      src.connect(audioCtx.destination);
-      src.start();
-    };
-  }
+// microphone returns a function turning the microphone on and off as the
+// server asks, for Siri and phone calls.
+const microphone = (send) => {
+  let stop = null;
+  return (on) => {
+    if (on && stop == null) {
+      stop = startMicrophone(send);
+    } else if (!on && stop != null) {
+      stop();
+      stop = null;
+    }
+  };
 };
 
-const touchData = pc.createDataChannel("touch");
-
-let pointerdown = false;
-const sendTouchEvent = ({ type, offsetX, offsetY }) => {
-  let action = 16;
-  if (type == "pointerdown") {
-    action = 14;
-    pointerdown = true;
-  } else if (pointerdown) {
-    switch (type) {
-      case "pointermove":
-        action = 15;
+// webRTCTimeout is how long WebRTC may take to connect before falling back to WebSocket.
+const webRTCTimeout = 10000;
+
+const startWebRTC = (config, fallback) => {
+  const pc = new RTCPeerConnection({ iceServers: config.iceServers });
+
+  let fellBack = false;
+  const fail = (reason) => {
+    if (fellBack) {
+      return;
+    }
+    fellBack = true;
+    console.warn("webrtc unavailable:", reason);
+    detachKeys();
+    detachSiri();
+    pc.close();
+    fallback();
+  };
+  const timer = setTimeout(() => fail("timeout"), webRTCTimeout);
+
+  pc.ontrack = (event) => {
+    if (video.srcObject == null) {
+      video.srcObject = event.streams[0];
+    } else {
+      video.srcObject.addTrack(event.track);
+    }
+  };
+
+  const startData = pc.createDataChannel("start");
+  startData.onopen = () => startData.send(JSON.stringify(screenSize()));
+
+  pc.oniceconnectionstatechange = () => {
+    console.log("connection:", pc.iceConnectionState);
+    switch (pc.iceConnectionState) {
+      case "connected":
+      case "completed":
+        clearTimeout(timer);
         break;
-      case "pointerup":
-      case "pointercancel":
-      case "pointerout":
-        pointerdown = false;
-        action = 16;
+      case "failed":
+        fail("ice failed");
         break;
     }
-  } else {
-    return;
-  }
-  const data = {
-    x: (offsetX * devicePixelRatio) | 0,
-    y: (offsetY * devicePixelRatio) | 0,
-    action,
   };
-  touchData.send(JSON.stringify(data));
-};
 
-video.addEventListener("pointerdown", sendTouchEvent);
-video.addEventListener("pointermove", sendTouchEvent);
-video.addEventListener("pointerup", sendTouchEvent);
-video.addEventListener("pointercancel", sendTouchEvent);
-video.addEventListener("pointerout", sendTouchEvent);
+  // Candidates are trickled once the answer tells where to send them.
+  let candidatesURL = null;
+  const pendingCandidates = [];
+  const sendCandidate = (candidate) =>
+    fetch(withToken(candidatesURL), {
+      method: "POST",
+      body: JSON.stringify(candidate),
+    }).catch(console.error);
+
+  pc.onicecandidate = ({ candidate }) => {
+    if (candidate == null) {
+      return;
+    }
+    if (candidatesURL == null) {
+      pendingCandidates.push(candidate);
+    } else {
+      sendCandidate(candidate);
+    }
+  };
+
+  const receiveCandidates = (location) => {
+    candidatesURL = `${location}/candidates`;
+    pendingCandidates.splice(0).forEach(sendCandidate);
+    const events = new EventSource(withToken(candidatesURL));
+    events.onmessage = (e) =>
+      pc.addIceCandidate(JSON.parse(e.data)).catch(console.error);
+    events.addEventListener("end", () => events.close());
+  };
+
+  pc.addTransceiver("video", { direction: "recvonly" });
+
+  pc.ondatachannel = ({ channel: dc }) => {
+    switch (dc.label) {
+      case "audio":
+        dc.onmessage = (e) => playAudio(e.data);
+        break;
+      case "microphone": {
+        const setMicrophone = microphone((pcm) => dc.send(pcm));
+        dc.onmessage = (e) => setMicrophone(JSON.parse(e.data).on);
+        dc.onclose = () => setMicrophone(false);
+        break;
+      }
+    }
+  };
 
-pc.createOffer()
-  .then((d) => pc.setLocalDescription(d))
-  .catch(console.error);
+  const touchData = pc.createDataChannel("touch");
+  attachTouch(video, (touch) => touchData.send(JSON.stringify(touch)));
+
+  const keyData = pc.createDataChannel("key");
+  const detachKeys = attachKeys((key) => keyData.send(JSON.stringify(key)));
+  const detachSiri = attachSiri((key) => keyData.send(JSON.stringify(key)));
+
+  pc.createOffer()
+    .then((d) => pc.setLocalDescription(d))
+    .then(() =>
+      fetch(withToken("/connect"), {
+        method: "POST",
+        body: JSON.stringify(pc.localDescription),
+      })
+    )
+    .then((res) =>
+      Promise.all([res.json(), res.ok, res.headers.get("Location")])
+    )
+    .then(([answer, ok, location]) => {
+      if (!ok) {
+        return Promise.reject(answer);
+      }
+      return pc
+        .setRemoteDescription(new RTCSessionDescription(answer))
+        .then(() => receiveCandidates(location));
+    })
+    .catch((e) => fail(e));
+};
+
+if (window.RTCPeerConnection) {
+  fetch(withToken("/config"))
+    .then((res) => (res.ok ? res.json() : Promise.reject(res.statusText)))
+    .catch((e) => {
+      console.error("config:", e);
+      return { iceServers: [] };
+    })
+    .then((config) => startWebRTC(config, startWebSocket));
+} else {
+  startWebSocket();
+}
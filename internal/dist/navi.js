@@ -0,0 +1,66 @@
+// Navigation video for a secondary display such as an instrument cluster. It
+// is pulled with WHEP and only watches; the main page starts the dongle.
+
+const video = document.querySelector("video");
+
+const token = new URLSearchParams(location.search).get("token");
+const withToken = (url) => {
+  if (!token) {
+    return url;
+  }
+  const u = new URL(url, location.href);
+  u.searchParams.set("token", token);
+  return u.toString();
+};
+
+// retryDelay is how long to wait before reconnecting after a failure.
+const retryDelay = 5000;
+
+const start = async () => {
+  const pc = new RTCPeerConnection();
+  const retry = (reason) => {
+    console.warn("navi:", reason);
+    pc.close();
+    setTimeout(start, retryDelay);
+  };
+
+  pc.ontrack = ({ track, streams }) => {
+    if (streams[0] && streams[0].id == "navi") {
+      video.srcObject = new MediaStream([track]);
+    }
+  };
+  pc.onconnectionstatechange = () => {
+    if (pc.connectionState == "failed") {
+      retry("connection failed");
+    }
+  };
+
+  // The first track is the main screen and the second the navigation video.
+  pc.addTransceiver("video", { direction: "recvonly" });
+  pc.addTransceiver("video", { direction: "recvonly" });
+
+  try {
+    await pc.setLocalDescription(await pc.createOffer());
+    await new Promise((resolve) => {
+      if (pc.iceGatheringState == "complete") {
+        resolve();
+      }
+      pc.onicegatheringstatechange = () =>
+        pc.iceGatheringState == "complete" && resolve();
+    });
+
+    const res = await fetch(withToken("/whep"), {
+      method: "POST",
+      headers: { "Content-Type": "application/sdp" },
+      body: pc.localDescription.sdp,
+    });
+    if (!res.ok) {
+      throw new Error(res.statusText);
+    }
+    await pc.setRemoteDescription({ type: "answer", sdp: await res.text() });
+  } catch (e) {
+    retry(e);
+  }
+};
+
+start();
@@ -0,0 +1,72 @@
+// Management page of the phones paired with the dongle.
+
+const token = new URLSearchParams(location.search).get("token");
+const withToken = (url) => {
+  if (!token) {
+    return url;
+  }
+  const u = new URL(url, location.href);
+  u.searchParams.set("token", token);
+  return u.toString();
+};
+
+const showError = (message) => {
+  document.getElementById("error").textContent = message;
+};
+
+const request = async (method, url) => {
+  const res = await fetch(withToken(url), { method });
+  if (!res.ok) {
+    const { error } = await res.json().catch(() => ({ error: res.statusText }));
+    throw new Error(error);
+  }
+  return res.status == 204 ? null : res.json();
+};
+
+const row = (...cells) => {
+  const tr = document.createElement("tr");
+  for (const cell of cells) {
+    const td = document.createElement("td");
+    td.append(cell);
+    tr.append(td);
+  }
+  return tr;
+};
+
+const render = ({ identity, paired, connected }) => {
+  // The PIN is only sent to clients allowed to control the phone.
+  document.getElementById("identity").replaceChildren(
+    row("Bluetooth name", identity.bluetoothName),
+    row("Bluetooth address", identity.bluetoothAddress),
+    ...(identity.bluetoothPIN ? [row("Bluetooth PIN", identity.bluetoothPIN)] : []),
+    row("Wi-Fi name", identity.wifiName),
+  );
+
+  const rows = paired.map(({ address, name }) => {
+    const forget = document.createElement("button");
+    forget.textContent = "Forget";
+    forget.onclick = () =>
+      request("DELETE", `/pairing/devices/${encodeURIComponent(address)}`)
+        .then(refresh)
+        .catch((e) => showError(e.message));
+    return row(name, address, address == connected ? "connected" : "", forget);
+  });
+  if (rows.length == 0) {
+    rows.push(row("No paired phones"));
+  }
+  document.getElementById("paired").replaceChildren(...rows);
+};
+
+const refresh = () =>
+  request("GET", "/pairing")
+    .then((state) => {
+      showError("");
+      render(state);
+    })
+    .catch((e) => showError(e.message));
+
+document.getElementById("connect").onclick = () =>
+  request("POST", "/pairing/connect").catch((e) => showError(e.message));
+
+refresh();
+setInterval(refresh, 5000);
@@ -0,0 +1,124 @@
+// WebSocket transport, used when WebRTC is unavailable. Video is decoded with
+// WebCodecs and drawn on the canvas.
+
+const wsKindVideo = 1;
+const wsKindAudio = 2;
+const wsKindControl = 3;
+
+// parseNALUnits returns the NAL units of an Annex-B access unit.
+const parseNALUnits = (data) => {
+  const units = [];
+  let start = -1;
+  for (let i = 0; i + 2 < data.length; i++) {
+    if (data[i] == 0 && data[i + 1] == 0 && data[i + 2] == 1) {
+      if (start >= 0) {
+        units.push(data.subarray(start, i));
+      }
+      i += 2;
+      start = i + 1;
+    }
+  }
+  if (start >= 0) {
+    units.push(data.subarray(start));
+  }
+  return units;
+};
+
+const hex = (b) => b.toString(16).padStart(2, "0");
+
+const startWebSocket = () => {
+  if (!window.VideoDecoder) {
+    console.error("neither WebRTC nor WebCodecs are available");
+    return;
+  }
+
+  video.hidden = true;
+  canvas.hidden = false;
+  const size = screenSize();
+  canvas.width = size.width;
+  canvas.height = size.height;
+  const ctx = canvas.getContext("2d");
+
+  const decoder = new VideoDecoder({
+    output: (frame) => {
+      ctx.drawImage(frame, 0, 0, canvas.width, canvas.height);
+      frame.close();
+    },
+    error: console.error,
+  });
+
+  const decodeVideo = (buffer) => {
+    const data = new Uint8Array(buffer);
+    let key = false;
+    for (const unit of parseNALUnits(data)) {
+      switch (unit[0] & 0x1f) {
+        case 5:
+          key = true;
+          break;
+        case 7:
+          if (decoder.state != "configured") {
+            decoder.configure({
+              codec: `avc1.${hex(unit[1])}${hex(unit[2])}${hex(unit[3])}`,
+              optimizeForLatency: true,
+            });
+          }
+          break;
+      }
+    }
+    if (decoder.state != "configured") {
+      return;
+    }
+    decoder.decode(
+      new EncodedVideoChunk({
+        type: key ? "key" : "delta",
+        timestamp: performance.now() * 1000,
+        data,
+      })
+    );
+  };
+
+  const protocol = location.protocol == "https:" ? "wss:" : "ws:";
+  const ws = new WebSocket(withToken(`${protocol}//${location.host}/ws`));
+  ws.binaryType = "arraybuffer";
+
+  const setMicrophone = microphone((pcm) => ws.send(pcm));
+
+  ws.onopen = () => ws.send(JSON.stringify({ type: "start", ...size }));
+  ws.onclose = () => {
+    console.log("websocket closed");
+    setMicrophone(false);
+  };
+
+  const control = (ctrl) => {
+    if (ctrl.type == "microphone") {
+      setMicrophone(!!ctrl.on);
+    }
+  };
+
+  ws.onmessage = ({ data }) => {
+    const dv = new DataView(data);
+    for (let off = 0; off + 5 <= data.byteLength; ) {
+      const kind = dv.getUint8(off);
+      const length = dv.getUint32(off + 1, true);
+      const payload = data.slice(off + 5, off + 5 + length);
+      off += 5 + length;
+      switch (kind) {
+        case wsKindVideo:
+          decodeVideo(payload);
+          break;
+        case wsKindAudio:
+          playAudio(payload);
+          break;
+        case wsKindControl:
+          control(JSON.parse(new TextDecoder().decode(payload)));
+          break;
+      }
+    }
+  };
+
+  attachTouch(canvas, (touch) =>
+    ws.send(JSON.stringify({ type: "touch", ...touch }))
+  );
+  attachKeys((key) => ws.send(JSON.stringify({ type: "key", ...key })));
+  attachSiri((key) => ws.send(JSON.stringify({ type: "key", ...key })));
+};
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is what an authenticated client is allowed to do.
+type Role int
+
+const (
+	RoleNone Role = iota
+	// RoleView may watch and listen.
+	RoleView
+	// RoleControl may also start CarPlay, touch the screen and press keys.
+	RoleControl
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleNone:
+		return "none"
+	case RoleView:
+		return "view"
+	case RoleControl:
+		return "control"
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole returns the Role named by s.
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "view":
+		return RoleView, nil
+	case "control":
+		return RoleControl, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", s)
+}
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// Authenticator decides the role of the client making a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Role, error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (Role, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Role, error) {
+	return f(r)
+}
+
+// challenger is implemented by authenticators that tell clients how to
+// authenticate through the WWW-Authenticate header.
+type challenger interface {
+	Challenge() string
+}
+
+type tokenAuth map[string]Role
+
+// TokenAuth authenticates clients by a shared token, sent either as a bearer
+// token or, for WebSocket and EventSource clients that cannot set headers,
+// as the token query parameter.
+func TokenAuth(tokens map[string]Role) Authenticator {
+	return tokenAuth(tokens)
+}
+
+func (a tokenAuth) Authenticate(r *http.Request) (Role, error) {
+	token := r.URL.Query().Get("token")
+	if auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = auth
+	}
+	if token == "" {
+		return RoleNone, ErrUnauthorized
+	}
+	for t, role := range a {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return role, nil
+		}
+	}
+	return RoleNone, ErrUnauthorized
+}
+
+func (a tokenAuth) Challenge() string {
+	return "Bearer"
+}
+
+// User is a client authenticated by HTTP basic authentication.
+type User struct {
+	Password string
+	Role     Role
+}
+
+type basicAuth struct {
+	realm string
+	users map[string]User
+}
+
+// BasicAuth authenticates clients by HTTP basic authentication against users,
+// keyed by user name.
+func BasicAuth(realm string, users map[string]User) Authenticator {
+	return &basicAuth{realm: realm, users: users}
+}
+
+func (a *basicAuth) Authenticate(r *http.Request) (Role, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return RoleNone, ErrUnauthorized
+	}
+	user, found := a.users[name]
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 || !found {
+		return RoleNone, ErrUnauthorized
+	}
+	return user.Role, nil
+}
+
+func (a *basicAuth) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q", a.realm)
+}
+
+type clientCertAuth func(cert *x509.Certificate) Role
+
+// ClientCertAuth authenticates clients by the TLS client certificate verified
+// by the server, whose tls.Config must request one. role decides the role of
+// a certificate; a nil role grants RoleControl to every verified certificate.
+func ClientCertAuth(role func(cert *x509.Certificate) Role) Authenticator {
+	return clientCertAuth(role)
+}
+
+func (a clientCertAuth) Authenticate(r *http.Request) (Role, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return RoleNone, ErrUnauthorized
+	}
+	if a == nil {
+		return RoleControl, nil
+	}
+	if role := a(r.TLS.VerifiedChains[0][0]); role != RoleNone {
+		return role, nil
+	}
+	return RoleNone, ErrUnauthorized
+}
+
+type anyAuth []Authenticator
+
+// AnyAuth authenticates clients by the first of auths that accepts them.
+func AnyAuth(auths ...Authenticator) Authenticator {
+	return anyAuth(auths)
+}
+
+func (a anyAuth) Authenticate(r *http.Request) (Role, error) {
+	for _, auth := range a {
+		if role, err := auth.Authenticate(r); err == nil && role != RoleNone {
+			return role, nil
+		}
+	}
+	return RoleNone, ErrUnauthorized
+}
+
+func (a anyAuth) Challenge() string {
+	var challenges []string
+	for _, auth := range a {
+		if c, ok := auth.(challenger); ok {
+			challenges = append(challenges, c.Challenge())
+		}
+	}
+	return strings.Join(challenges, ", ")
+}
+
+type roleKey struct{}
+
+// roleFrom returns the role of the client the context of whose request is ctx.
+func roleFrom(ctx context.Context) Role {
+	if role, ok := ctx.Value(roleKey{}).(Role); ok {
+		return role
+	}
+	return RoleNone
+}
+
+// require wraps h so that it is only served to clients with at least role.
+// Without an authenticator every client has RoleControl.
+func (s *Server) require(role Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		granted := RoleControl
+		if s.auth != nil {
+			var err error
+			granted, err = s.auth.Authenticate(r)
+			if err != nil {
+				if c, ok := s.auth.(challenger); ok {
+					w.Header().Set("WWW-Authenticate", c.Challenge())
+				}
+				writeError(w, http.StatusUnauthorized, err)
+				return
+			}
+		}
+		if granted < role {
+			writeError(w, http.StatusForbidden, ErrForbidden)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), roleKey{}, granted)))
+	}
+}
+
+// allowControl reports whether sess may control the phone, logging when it may not.
+func (s *Server) allowControl(sess *session, action string) bool {
+	if sess.role >= RoleControl {
+		return true
+	}
+	s.Warn("control denied", "action", action, "role", sess.role.String())
+	return false
+}
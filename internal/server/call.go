@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// callTracker keeps the state of the phone call for clients.
+type callTracker struct {
+	mu    sync.Mutex
+	event link.CallEvent
+	notifier
+}
+
+func newCallTracker() *callTracker {
+	return &callTracker{notifier: newNotifier()}
+}
+
+func (c *callTracker) update(event link.CallEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.event = event
+	c.notify()
+}
+
+// callState is the JSON served by /call.
+type callState struct {
+	// State is idle, ringing or active.
+	State string `json:"state"`
+	// Event is the last event: ringing, started or ended.
+	Event string `json:"event,omitempty"`
+}
+
+// state returns the current state and a channel closed on the next event.
+func (c *callTracker) state() (callState, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := callState{State: link.CallIdle.String()}
+	switch c.event {
+	case link.Ringing:
+		state.State = link.CallRinging.String()
+	case link.CallStarted:
+		state.State = link.CallActive.String()
+	}
+	if c.event != 0 {
+		state.Event = c.event.String()
+	}
+	return state, c.changed
+}
+
+// callHandler serves the state of the phone call as JSON, or as a stream of
+// server-sent events of every call event when the client accepts them.
+func (s *Server) callHandler(w http.ResponseWriter, r *http.Request) {
+	s.serveState(w, r, "call state", func() (any, <-chan struct{}) {
+		state, changed := s.call.state()
+		return &state, changed
+	})
+}
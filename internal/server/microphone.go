@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// microphone asks the sessions that may control the phone to start or stop
+// sending their microphone, for Siri and phone calls.
+func (s *Server) microphone(on bool) {
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		if sess.role >= RoleControl && sess.onMicrophone != nil {
+			sessions = append(sessions, sess)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.onMicrophone(on)
+	}
+}
+
+// sendMicrophone sends the 16kHz mono PCM samples recorded by the client of sess.
+func (s *Server) sendMicrophone(lnk *link.Link, sess *session, pcm []byte) {
+	if !s.allowControl(sess, "microphone") {
+		return
+	}
+	if err := lnk.SendMicrophone(pcm); err != nil {
+		s.Error("send microphone", "error", err.Error())
+	}
+}
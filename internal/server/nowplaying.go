@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// nowPlaying tracks the media playing on the phone from the updates of the dongle.
+type nowPlaying struct {
+	mu   sync.Mutex
+	info protocol.MediaInfo
+	art  []byte
+	// artVersion is incremented with every album art, so that clients reload it.
+	artVersion int
+	notifier
+}
+
+func newNowPlaying() *nowPlaying {
+	return &nowPlaying{notifier: newNotifier()}
+}
+
+// update applies a *protocol.MediaInfo or *protocol.AlbumArt received from the dongle.
+func (n *nowPlaying) update(media any) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch media := media.(type) {
+	case *protocol.MediaInfo:
+		n.info.Merge(media)
+	case *protocol.AlbumArt:
+		n.art = media.Data
+		n.artVersion++
+	default:
+		return
+	}
+	n.notify()
+}
+
+// nowPlayingState is the JSON served by /nowplaying.
+type nowPlayingState struct {
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+	App    string `json:"app"`
+	// Duration and Position are in milliseconds.
+	Duration int64 `json:"duration"`
+	Position int64 `json:"position"`
+	// Art is the URL of the album art, if any.
+	Art string `json:"art,omitempty"`
+}
+
+// state returns the current state and a channel closed on the next update.
+func (n *nowPlaying) state() (nowPlayingState, <-chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	state := nowPlayingState{
+		Title:    n.info.Title,
+		Artist:   n.info.Artist,
+		Album:    n.info.Album,
+		App:      n.info.App,
+		Duration: n.info.Duration,
+		Position: n.info.Position,
+	}
+	if len(n.art) > 0 {
+		state.Art = fmt.Sprintf("/nowplaying/art?v=%d", n.artVersion)
+	}
+	return state, n.changed
+}
+
+// nowPlayingHandler serves what is playing as JSON, or as a stream of
+// server-sent events of every update when the client accepts them.
+func (s *Server) nowPlayingHandler(w http.ResponseWriter, r *http.Request) {
+	s.serveState(w, r, "now playing", func() (any, <-chan struct{}) {
+		state, changed := s.nowPlaying.state()
+		return &state, changed
+	})
+}
+
+// albumArtHandler serves the album art of what is playing.
+func (s *Server) albumArtHandler(w http.ResponseWriter, r *http.Request) {
+	s.nowPlaying.mu.Lock()
+	art := s.nowPlaying.art
+	s.nowPlaying.mu.Unlock()
+	if len(art) == 0 {
+		writeError(w, http.StatusNotFound, ErrResourceNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(art))
+	w.Write(art)
+}
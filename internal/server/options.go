@@ -1,6 +1,13 @@
 package server
 
-import "context"
+import (
+	"context"
+	"errors"
+
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/recorder"
+	"github.com/pion/webrtc/v3"
+)
 
 type Option interface {
 	apply(*Server) error
@@ -32,3 +39,102 @@ func WithLogger(logger Logger) Option {
 		return nil
 	})
 }
+
+// WithRecorder enables the /record endpoints, which start and stop rec.
+func WithRecorder(rec *recorder.Recorder) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.recorder = rec
+		return nil
+	})
+}
+
+// WithScreenSize sets the screen size WHEP players open the dongle with, so
+// that they can pull the video without a browser starting it. Without it, WHEP
+// players only watch once a control client has started the dongle.
+func WithScreenSize(size link.ScreenSize) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.size = size
+		return nil
+	})
+}
+
+// WithICEServers sets the STUN and TURN servers used by the server and
+// offered to clients through /config. Without any servers only host
+// candidates are used, which suits LAN-only in-car networks.
+func WithICEServers(servers ...webrtc.ICEServer) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.iceServers = servers
+		return nil
+	})
+}
+
+// WithNAT1To1IPs advertises ips as host candidates in place of the local
+// addresses, for servers behind a 1:1 NAT.
+func WithNAT1To1IPs(ips ...string) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.nat1To1IPs = ips
+		return nil
+	})
+}
+
+// WithUDPPortRange limits the UDP ports used for ICE to min through max.
+func WithUDPPortRange(min, max uint16) Option {
+	return applyOptionFunc(func(s *Server) error {
+		if min == 0 || max < min {
+			return errors.New("invalid udp port range")
+		}
+		s.udpPortMin = min
+		s.udpPortMax = max
+		return nil
+	})
+}
+
+// WithICELite makes the server an ICE lite agent, which only answers
+// connectivity checks. The server must be directly reachable by clients.
+func WithICELite(lite bool) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.iceLite = lite
+		return nil
+	})
+}
+
+// WithAuthenticator requires clients to authenticate with auth. Without it
+// every client may control the phone.
+func WithAuthenticator(auth Authenticator) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.auth = auth
+		return nil
+	})
+}
+
+func WithFPS(fps int32) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.fps = fps
+		return nil
+	})
+}
+
+func WithDPI(dpi int32) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.dpi = dpi
+		return nil
+	})
+}
+
+// WithDongleConfig sets the settings written to the dongle when it is connected.
+func WithDongleConfig(cfg link.DongleConfig) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.dongleCfg = cfg
+		return nil
+	})
+}
+
+// WithNaviVideo publishes the navigation video of dongles supporting it at
+// size and fps, as a second video track of every peer connection.
+func WithNaviVideo(size link.ScreenSize, fps int32) Option {
+	return applyOptionFunc(func(s *Server) error {
+		s.naviSize = size
+		s.naviFPS = fps
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// pairingState is the JSON served by /pairing.
+type pairingState struct {
+	Identity  link.Identity       `json:"identity"`
+	Paired    []link.PairedDevice `json:"paired"`
+	Connected string              `json:"connected"`
+}
+
+// ErrNotOpen is returned when the dongle was not opened by a control client.
+var ErrNotOpen = errors.New("dongle not open")
+
+// pairing returns the pairing state of the dongle, or ErrNotOpen until a
+// control client opened it: managing pairings does not start a session.
+func (s *Server) pairing() (*link.Pairing, error) {
+	s.mu.Lock()
+	lnk, started := s.lnk, s.started
+	s.mu.Unlock()
+	if !started {
+		return nil, ErrNotOpen
+	}
+	return lnk.Pairing(), nil
+}
+
+// pairingHandler serves the pairing state reported by the dongle so far. It
+// does not open the dongle, which is left to control clients.
+func (s *Server) pairingHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := s.pairing()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	state := pairingState{
+		Identity:  p.Identity(),
+		Paired:    p.Paired(),
+		Connected: p.Connected(),
+	}
+	if state.Paired == nil {
+		state.Paired = []link.PairedDevice{}
+	}
+	// The PIN lets a phone pair with the car, which only control clients may do.
+	if roleFrom(r.Context()) < RoleControl {
+		state.Identity.BluetoothPIN = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&state)
+}
+
+func (s *Server) forgetDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := s.pairing()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	switch err := p.Forget(r.PathValue("address")); {
+	case errors.Is(err, link.ErrUnknownDevice):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, link.ErrUnsupported):
+		writeError(w, http.StatusNotImplemented, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) connectLastHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := s.pairing()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err := p.ConnectLast(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// peer is a peer connection addressable by id, created by /connect or /whep.
+type peer struct {
+	pc   *webrtc.PeerConnection
+	sess *session
+	mids []string
+
+	mu         sync.Mutex
+	candidates []webrtc.ICECandidateInit
+	gathered   bool
+	notifier
+}
+
+func newPeer(pc *webrtc.PeerConnection, sess *session) *peer {
+	p := &peer{
+		pc:       pc,
+		sess:     sess,
+		notifier: newNotifier(),
+	}
+	pc.OnICECandidate(p.onICECandidate)
+	return p
+}
+
+func (p *peer) onICECandidate(c *webrtc.ICECandidate) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c == nil {
+		p.gathered = true
+	} else {
+		p.candidates = append(p.candidates, c.ToJSON())
+	}
+	p.notify()
+}
+
+// candidatesSince returns the local candidates gathered after the first n,
+// whether gathering is complete and a channel closed on the next change.
+func (p *peer) candidatesSince(n int) ([]webrtc.ICECandidateInit, bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.candidates[n:], p.gathered, p.changed
+}
+
+func (p *peer) mLineIndex(mid string) uint16 {
+	for i, m := range p.mids {
+		if m == mid {
+			return uint16(i)
+		}
+	}
+	return 0
+}
+
+// register makes p addressable and attaches its session.
+func (s *Server) register(p *peer) (string, error) {
+	id, err := newResourceID()
+	if err != nil {
+		return "", err
+	}
+	for _, t := range p.pc.GetTransceivers() {
+		p.mids = append(p.mids, t.Mid())
+	}
+
+	s.mu.Lock()
+	s.peers[id] = p
+	s.mu.Unlock()
+	s.attach(p.sess)
+
+	p.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		s.Info("peer connection state", "id", id, "state", state.String())
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			s.closePeer(id)
+		}
+	})
+	return id, nil
+}
+
+func (s *Server) peer(id string) *peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peers[id]
+}
+
+// closePeer tears down the peer id and reports whether it existed.
+func (s *Server) closePeer(id string) bool {
+	s.mu.Lock()
+	p, ok := s.peers[id]
+	delete(s.peers, id)
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	s.detach(p.sess)
+	if err := p.pc.Close(); err != nil {
+		s.Error("close peer", "error", err.Error())
+	}
+	return true
+}
+
+// remoteCandidateHandler adds a candidate trickled by the client, encoded
+// as the JSON of RTCIceCandidate.
+func (s *Server) remoteCandidateHandler(w http.ResponseWriter, r *http.Request) {
+	p := s.peer(r.PathValue("id"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, ErrResourceNotFound)
+		return
+	}
+	var candidate webrtc.ICECandidateInit
+	if err := json.NewDecoder(r.Body).Decode(&candidate); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.pc.AddICECandidate(candidate); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// localCandidatesHandler streams the server's candidates as server-sent
+// events, ending with an "end" event once gathering is complete.
+func (s *Server) localCandidatesHandler(w http.ResponseWriter, r *http.Request) {
+	p := s.peer(r.PathValue("id"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, ErrResourceNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrStreamingUnsupported)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	sent := 0
+	for {
+		candidates, gathered, changed := p.candidatesSince(sent)
+		for _, c := range candidates {
+			data, err := json.Marshal(c)
+			if err != nil {
+				s.Error("marshal candidate", "error", err.Error())
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		sent += len(candidates)
+		if gathered {
+			fmt.Fprint(w, "event: end\ndata:\n\n")
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func newResourceID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mzyy94/gocarplay/recorder"
+)
+
+var ErrNoRecorder = errors.New("recorder not configured")
+
+func (s *Server) recordStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if s.recorder == nil {
+		writeError(w, http.StatusNotFound, ErrNoRecorder)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.recorder.Status())
+}
+
+func (s *Server) recordStartHandler(w http.ResponseWriter, r *http.Request) {
+	if s.recorder == nil {
+		writeError(w, http.StatusNotFound, ErrNoRecorder)
+		return
+	}
+	if err := s.recorder.Start(); err != nil {
+		if errors.Is(err, recorder.ErrAlreadyStarted) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.recordStatusHandler(w, r)
+}
+
+func (s *Server) recordStopHandler(w http.ResponseWriter, r *http.Request) {
+	if s.recorder == nil {
+		writeError(w, http.StatusNotFound, ErrNoRecorder)
+		return
+	}
+	// Status is taken before stopping so that the response lists the files written.
+	status := s.recorder.Status()
+	if err := s.recorder.Stop(); err != nil {
+		if errors.Is(err, recorder.ErrNotStarted) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	status.Recording = false
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -1,19 +1,17 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"sync"
 
 	"github.com/mzyy94/gocarplay/link"
 	"github.com/mzyy94/gocarplay/protocol"
+	"github.com/mzyy94/gocarplay/recorder"
 	"github.com/pion/webrtc/v3"
-	"github.com/pion/webrtc/v3/pkg/media"
 )
 
 var Connect = func(ctx context.Context) (io.Reader, io.Writer, error) {
@@ -42,24 +40,88 @@ type Connector interface {
 }
 
 type Server struct {
-	ctx              context.Context
-	videoTrack       *webrtc.TrackLocalStaticSample
-	audioDataChannel *webrtc.DataChannel
-	size             *link.ScreenSize
-	fps              int32
-	logger           Logger
-	connector        Connector
-	in               io.Reader
-	out              io.Writer
+	ctx       context.Context
+	fps       int32
+	dpi       int32
+	size      link.ScreenSize
+	dongleCfg link.DongleConfig
+	logger    Logger
+	connector Connector
+	recorder  *recorder.Recorder
+	auth      Authenticator
+	mux       *http.ServeMux
+
+	iceServers []webrtc.ICEServer
+	nat1To1IPs []string
+	udpPortMin uint16
+	udpPortMax uint16
+	iceLite    bool
+
+	// naviSize is the size of the navigation video, which is disabled when zero.
+	naviSize link.ScreenSize
+	naviFPS  int32
+
+	// connectMu serializes the connections to the dongle, which take seconds
+	// and are made without holding mu.
+	connectMu sync.Mutex
+
+	// The dongle is shared by every client; it is connected by the first one.
+	mu       sync.Mutex
+	lnk      *link.Link
+	started  bool
+	sessions map[*session]struct{}
+	peers    map[string]*peer
+
+	nowPlaying *nowPlaying
+	call       *callTracker
+}
+
+// session is a client attached to the dongle through one of the transports.
+type session struct {
+	// size is the size of the client's screen, which touches are relative to.
+	// It is guarded by mu, as data channels deliver messages concurrently.
+	mu     sync.Mutex
+	size   link.ScreenSize
+	role   Role
+	onData func(any)
+	// onMicrophone, when set, is called when the phone starts or stops
+	// listening to the microphone of the client.
+	onMicrophone func(on bool)
+}
+
+// screenSize returns the size of the client's screen.
+func (sess *session) screenSize() link.ScreenSize {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.size
+}
+
+func (sess *session) setScreenSize(size link.ScreenSize) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.size = size
 }
 
 func NewServer(opts ...Option) (http.Handler, error) {
 	s := &Server{
 		ctx: context.Background(),
 		fps: 25,
+		dpi: 160,
+
+		dongleCfg: link.DefaultDongleConfig,
 		connector: ConnectFunc(func(ctx context.Context) (io.Reader, io.Writer, error) {
 			return Connect(ctx)
 		}),
+		sessions: make(map[*session]struct{}),
+		peers:    make(map[string]*peer),
+
+		nowPlaying: newNowPlaying(),
+		call:       newCallTracker(),
+		iceServers: []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.l.google.com:19302"},
+			},
+		},
 	}
 
 	for _, opt := range opts {
@@ -67,6 +129,26 @@ func NewServer(opts ...Option) (http.Handler, error) {
 			return nil, err
 		}
 	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /config", s.require(RoleView, s.configHandler))
+	s.mux.HandleFunc("/connect", s.require(RoleView, s.webRTCOfferHandler))
+	s.mux.HandleFunc("POST /connect/{id}/candidates", s.require(RoleView, s.remoteCandidateHandler))
+	s.mux.HandleFunc("GET /connect/{id}/candidates", s.require(RoleView, s.localCandidatesHandler))
+	s.mux.HandleFunc("GET /ws", s.require(RoleView, s.webSocketHandler))
+	s.mux.HandleFunc("OPTIONS /whep", s.whepOptionsHandler)
+	s.mux.HandleFunc("POST /whep", s.require(RoleView, s.whepOfferHandler))
+	s.mux.HandleFunc("PATCH /whep/{id}", s.require(RoleView, s.whepPatchHandler))
+	s.mux.HandleFunc("DELETE /whep/{id}", s.require(RoleView, s.whepDeleteHandler))
+	s.mux.HandleFunc("GET /record", s.require(RoleView, s.recordStatusHandler))
+	s.mux.HandleFunc("POST /record/start", s.require(RoleControl, s.recordStartHandler))
+	s.mux.HandleFunc("POST /record/stop", s.require(RoleControl, s.recordStopHandler))
+	s.mux.HandleFunc("GET /nowplaying", s.require(RoleView, s.nowPlayingHandler))
+	s.mux.HandleFunc("GET /nowplaying/art", s.require(RoleView, s.albumArtHandler))
+	s.mux.HandleFunc("GET /call", s.require(RoleView, s.callHandler))
+	s.mux.HandleFunc("GET /pairing", s.require(RoleView, s.pairingHandler))
+	s.mux.HandleFunc("DELETE /pairing/devices/{address}", s.require(RoleControl, s.forgetDeviceHandler))
+	s.mux.HandleFunc("POST /pairing/connect", s.require(RoleControl, s.connectLastHandler))
 	return s, nil
 }
 
@@ -95,182 +177,198 @@ func (s *Server) Error(msg string, args ...any) {
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.webRTCOfferHandler(w, r)
+	s.mux.ServeHTTP(w, r)
 }
 
-func (s *Server) webRTCOfferHandler(w http.ResponseWriter, r *http.Request) {
-	var offer webrtc.SessionDescription
-	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "{\"error\": \"%s\"}", err.Error())
-		return
-	}
+// clientConfig is the configuration served to the bundled UI.
+type clientConfig struct {
+	ICEServers []webrtc.ICEServer `json:"iceServers"`
+}
 
-	answer, err := s.setupWebRTC(r.Context(), offer)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "{\"error\": \"%s\"}", err.Error())
-		return
+func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
+	config := clientConfig{ICEServers: s.iceServers}
+	if config.ICEServers == nil {
+		config.ICEServers = []webrtc.ICEServer{}
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(&answer)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&config)
 }
 
-func (s *Server) setupWebRTC(ctx context.Context, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
-	// todo make this listen from kill or term signal
-	// how many times does this run?
-
-	s.Debug("setup web rtc")
+// dongle returns the link to the dongle, connecting to it on first use.
+func (s *Server) dongle() (*link.Link, error) {
+	if lnk := s.connected(); lnk != nil {
+		return lnk, nil
+	}
+	s.connectMu.Lock()
+	defer s.connectMu.Unlock()
+	// Another client may have connected while this one waited.
+	if lnk := s.connected(); lnk != nil {
+		return lnk, nil
+	}
 
-	var err error
-	s.in, s.out, err = s.connector.Connect(ctx)
+	s.Debug("connect dongle")
+	in, out, err := s.connector.Connect(s.ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	lnk, err := link.New(
-		link.WithContext(context.Background()),
-		link.WithDPI(160),
+		link.WithContext(s.ctx),
+		link.WithDPI(s.dpi),
 		link.WithFPS(s.fps),
-		link.WithReader(s.in),
-		link.WithWriter(s.out),
+		link.WithDongleConfig(s.dongleCfg),
+		link.WithLogger(s.logger),
+		link.WithReader(in),
+		link.WithWriter(out),
 	)
 	if err != nil {
 		return nil, err
 	}
+	lnk.OnMedia(s.nowPlaying.update)
+	lnk.OnCall(s.call.update)
+	lnk.OnMicrophone(s.microphone)
+	s.mu.Lock()
+	s.lnk = lnk
+	s.mu.Unlock()
+	return lnk, nil
+}
 
-	// WebRTC setup
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
-	}
-	mediaEngine := webrtc.MediaEngine{}
-
-	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
-		return nil, err
-	}
-
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(&mediaEngine))
-
-	pc, err := api.NewPeerConnection(config)
-	if err != nil {
-		return nil, err
-	}
+// connected returns the link to the dongle, nil until it is connected.
+func (s *Server) connected() *link.Link {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lnk
+}
 
-	stats, ok := pc.GetStats().GetConnectionStats(pc)
-	if !ok {
-		stats.ID = "unknown"
-	}
+func (s *Server) attach(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess] = struct{}{}
+}
 
-	pc.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
-		s.Info("state of %s: %s", stats.ID, connectionState.String())
-	})
-
-	// Create a video track
-	videoCodec := webrtc.RTPCodecCapability{
-		MimeType:     webrtc.MimeTypeH264,
-		ClockRate:    90000,
-		Channels:     0,
-		SDPFmtpLine:  "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640032",
-		RTCPFeedback: nil,
-	}
+func (s *Server) detach(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sess)
+}
 
-	if s.videoTrack, err = webrtc.NewTrackLocalStaticSample(videoCodec, "video", "video"); err != nil {
-		return nil, err
+// dispatch hands data received from the dongle to the recorder and every
+// session, which must not keep the buffers of video frames.
+func (s *Server) dispatch(data any) {
+	if s.recorder != nil {
+		s.recorder.OnData(data)
 	}
 
-	if _, err = pc.AddTransceiverFromTrack(s.videoTrack,
-		webrtc.RtpTransceiverInit{
-			Direction: webrtc.RTPTransceiverDirectionSendonly,
-		},
-	); err != nil {
-		return nil, err
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
 	}
+	s.mu.Unlock()
 
-	// Create a data channels
-	s.audioDataChannel, err = pc.CreateDataChannel("audio", nil)
-	if err != nil {
-		return nil, err
+	for _, sess := range sessions {
+		sess.onData(data)
 	}
 
-	pc.OnDataChannel(func(d *webrtc.DataChannel) {
-		switch d.Label() {
-		case "touch":
-			d.OnMessage(func(msg webrtc.DataChannelMessage) {
-				s.sendTouch(lnk, msg.Data)
-			})
-		case "start":
-			d.OnMessage(func(msg webrtc.DataChannelMessage) {
-				if err := s.startCarPlay(lnk, msg.Data); err != nil {
-					s.Error("start car play", "error", err.Error())
-				}
-			})
-		}
-	})
-
-	// Set the remote SessionDescription
-	if err := pc.SetRemoteDescription(offer); err != nil {
-		return nil, err
+	// Every session is done with the frame, whose buffer is reused.
+	switch data := data.(type) {
+	case *protocol.VideoData:
+		data.Release()
+	case *protocol.NaviVideoData:
+		data.Release()
 	}
+}
 
-	// Create an answer
-	answer, err := pc.CreateAnswer(nil)
-	if err != nil {
-		return nil, err
+// startCarPlay records the screen size of sess and, for the first session,
+// opens the dongle with it and starts receiving.
+func (s *Server) startCarPlay(lnk *link.Link, sess *session, data []byte) error {
+	var size link.ScreenSize
+	if err := json.Unmarshal(data, &size); err != nil {
+		return err
 	}
-
-	// Sets the LocalDescription, and starts our UDP listeners
-	if err = pc.SetLocalDescription(answer); err != nil {
-		return nil, err
+	sess.setScreenSize(size)
+	if !s.allowControl(sess, "start") {
+		return nil
 	}
-
-	return &answer, nil
+	return s.open(lnk, size)
 }
 
-func (s *Server) startCarPlay(lnk *link.Link, data []byte) error {
-
-	if err := json.Unmarshal(data, s.size); err != nil {
-		return err
+// open opens the dongle with size and starts receiving, unless it already is.
+func (s *Server) open(lnk *link.Link, size link.ScreenSize) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return nil
 	}
 
-	if err := lnk.SetScreenSize(*s.size); err != nil {
+	if err := lnk.SetScreenSize(size); err != nil {
 		return err
 	}
-	go lnk.Communicate(func(data interface{}) {
-		switch data := data.(type) {
-		case *protocol.VideoData:
-			duration := time.Duration((float32(1) / float32(s.fps)) * float32(time.Second))
-
-			s.videoTrack.WriteSample(media.Sample{Data: data.Data, Duration: duration})
-		case *protocol.AudioData:
-			if len(data.Data) == 0 {
-				s.Debug("[onData]", "data", data)
-			} else {
-				var buf bytes.Buffer
-				fr := protocol.AudioDecodeTypes[data.DecodeType].Frequency
-				ch := protocol.AudioDecodeTypes[data.DecodeType].Channel
-				binary.Write(&buf, binary.LittleEndian, fr)
-				binary.Write(&buf, binary.LittleEndian, ch)
-				s.audioDataChannel.Send(append(buf.Bytes(), data.Data...))
-			}
-		default:
-			s.Debug("[onData]", "data", data)
+	if s.naviSize.Width != 0 {
+		if err := lnk.EnableNaviVideo(s.naviSize, s.naviFPS); err != nil {
+			s.Warn("enable navigation video", "error", err.Error())
 		}
-	})
+	}
+	s.started = true
+	go lnk.Communicate(s.dispatch)
 
 	return nil
 }
 
-func (s *Server) sendTouch(lnk *link.Link, data []byte) {
+func (s *Server) sendTouch(lnk *link.Link, sess *session, data []byte) {
+	if !s.allowControl(sess, "touch") {
+		return
+	}
 	var touch link.ScreenTouch
 	if err := json.Unmarshal(data, &touch); err != nil {
 		s.Error("unmarshal touch", "error", err.Error())
 		return
 	}
+	size := sess.screenSize()
+	if size.Width == 0 || size.Height == 0 {
+		s.Warn("touch before start")
+		return
+	}
+
+	if err := lnk.SendTouch(touch, size); err != nil {
+		s.Error("send touch", "error", err.Error())
+	}
+}
+
+// screenKey is a key press sent by a client, such as a steering wheel button.
+// Name is mapped to the command of the connected phone on press and, when Up
+// is set, on release; Key is sent as is.
+type screenKey struct {
+	Key  protocol.CarPlayType `json:"key"`
+	Name link.Key             `json:"name"`
+	Up   bool                 `json:"up"`
+}
+
+func (s *Server) sendKey(lnk *link.Link, sess *session, data []byte) {
+	if !s.allowControl(sess, "key") {
+		return
+	}
+	var key screenKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		s.Error("unmarshal key", "error", err.Error())
+		return
+	}
+
+	var err error
+	if key.Name != "" {
+		err = lnk.SendKey(key.Name, !key.Up)
+	} else {
+		err = lnk.Send(&protocol.CarPlay{Command: key.Key})
+	}
+	if err != nil {
+		s.Error("send key", "error", err.Error())
+	}
+}
 
-	lnk.Send(&protocol.Touch{X: uint32(touch.X * 10000 / float32(s.size.Width)), Y: uint32(touch.Y * 10000 / float32(s.size.Height)), Action: protocol.TouchAction(touch.Action)})
+// writeError writes err as the JSON error of a response with code.
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	msg, _ := json.Marshal(err.Error())
+	fmt.Fprintf(w, "{\"error\": %s}", msg)
 }
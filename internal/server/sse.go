@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// notifier tells watchers of a state that it changed by closing its channel,
+// which is replaced for the next change. Its methods are called with the lock
+// of the state held.
+type notifier struct {
+	changed chan struct{}
+}
+
+func newNotifier() notifier {
+	return notifier{changed: make(chan struct{})}
+}
+
+// notify wakes up the watchers of the current channel.
+func (n *notifier) notify() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// serveState serves the state returned by state as JSON, or as a stream of
+// server-sent events of every change when the client accepts them. state
+// returns the current state and a channel closed on the next change.
+func (s *Server) serveState(w http.ResponseWriter, r *http.Request, name string, state func() (any, <-chan struct{})) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		current, _ := state()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrStreamingUnsupported)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for {
+		current, changed := state()
+		data, err := json.Marshal(current)
+		if err != nil {
+			s.Error("marshal "+name, "error", err.Error())
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const connectResourcePathPrefix = "/connect/"
+
+func (s *Server) webRTCOfferHandler(w http.ResponseWriter, r *http.Request) {
+	var offer webrtc.SessionDescription
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, answer, err := s.setupWebRTC(r.Context(), offer)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Candidates are trickled through /connect/{id}/candidates.
+	w.Header().Set("Location", connectResourcePathPrefix+id)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&answer)
+}
+
+// setupWebRTC answers offer without waiting for candidates to be gathered.
+// It returns the id of the peer, through which candidates are exchanged.
+func (s *Server) setupWebRTC(ctx context.Context, offer webrtc.SessionDescription) (string, *webrtc.SessionDescription, error) {
+	s.Debug("setup web rtc")
+
+	lnk, err := s.dongle()
+	if err != nil {
+		return "", nil, err
+	}
+
+	pc, videoTrack, err := s.newPeerConnection()
+	if err != nil {
+		return "", nil, err
+	}
+	naviTrack, err := s.addNaviTrack(pc)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	stats, ok := pc.GetStats().GetConnectionStats(pc)
+	if !ok {
+		stats.ID = "unknown"
+	}
+
+	// Create a data channels
+	audioDataChannel, err := pc.CreateDataChannel("audio", nil)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	// The client is asked for its microphone, which it sends back, on the
+	// microphone channel.
+	micDataChannel, err := pc.CreateDataChannel("microphone", nil)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	sess := &session{
+		role: roleFrom(ctx),
+		onData: func(data any) {
+			switch data := data.(type) {
+			case *protocol.VideoData:
+				s.writeVideoSample(videoTrack, data, s.fps)
+			case *protocol.NaviVideoData:
+				if naviTrack != nil {
+					s.writeVideoSample(naviTrack, (*protocol.VideoData)(data), s.naviFPS)
+				}
+			case *protocol.AudioData:
+				if len(data.Data) == 0 {
+					s.Debug("[onData]", "data", data)
+				} else {
+					audioDataChannel.Send(audioPacket(data))
+				}
+			default:
+				s.Debug("[onData]", "data", data)
+			}
+		},
+		onMicrophone: func(on bool) {
+			micDataChannel.SendText(fmt.Sprintf(`{"on":%t}`, on))
+		},
+	}
+	micDataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !msg.IsString {
+			s.sendMicrophone(lnk, sess, msg.Data)
+		}
+	})
+	p := newPeer(pc, sess)
+
+	pc.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
+		s.Info("ice connection state", "id", stats.ID, "state", connectionState.String())
+	})
+
+	pc.OnDataChannel(func(d *webrtc.DataChannel) {
+		switch d.Label() {
+		case "touch":
+			d.OnMessage(func(msg webrtc.DataChannelMessage) {
+				s.sendTouch(lnk, sess, msg.Data)
+			})
+		case "start":
+			d.OnMessage(func(msg webrtc.DataChannelMessage) {
+				if err := s.startCarPlay(lnk, sess, msg.Data); err != nil {
+					s.Error("start car play", "error", err.Error())
+				}
+			})
+		case "key":
+			d.OnMessage(func(msg webrtc.DataChannelMessage) {
+				s.sendKey(lnk, sess, msg.Data)
+			})
+		}
+	})
+
+	// Set the remote SessionDescription
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	// Create an answer
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	// Sets the LocalDescription, and starts our UDP listeners
+	if err = pc.SetLocalDescription(answer); err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	id, err := s.register(p)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	return id, &answer, nil
+}
+
+// newPeerConnection creates a peer connection sending an H.264 video track.
+func (s *Server) newPeerConnection() (*webrtc.PeerConnection, *webrtc.TrackLocalStaticSample, error) {
+	config := webrtc.Configuration{
+		ICEServers: s.iceServers,
+	}
+	mediaEngine := webrtc.MediaEngine{}
+
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, nil, err
+	}
+
+	settingEngine := webrtc.SettingEngine{}
+	if len(s.nat1To1IPs) > 0 {
+		settingEngine.SetNAT1To1IPs(s.nat1To1IPs, webrtc.ICECandidateTypeHost)
+	}
+	if s.udpPortMin != 0 || s.udpPortMax != 0 {
+		if err := settingEngine.SetEphemeralUDPPortRange(s.udpPortMin, s.udpPortMax); err != nil {
+			return nil, nil, err
+		}
+	}
+	settingEngine.SetLite(s.iceLite)
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(&mediaEngine), webrtc.WithSettingEngine(settingEngine))
+
+	pc, err := api.NewPeerConnection(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create a video track
+	videoCodec := webrtc.RTPCodecCapability{
+		MimeType:     webrtc.MimeTypeH264,
+		ClockRate:    90000,
+		Channels:     0,
+		SDPFmtpLine:  "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640032",
+		RTCPFeedback: nil,
+	}
+
+	videoTrack, err := webrtc.NewTrackLocalStaticSample(videoCodec, "video", "video")
+	if err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	if _, err = pc.AddTransceiverFromTrack(videoTrack,
+		webrtc.RtpTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		},
+	); err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	return pc, videoTrack, nil
+}
+
+// addNaviTrack adds a track for the navigation video to pc, in a stream of
+// its own named "navi", if it is enabled.
+func (s *Server) addNaviTrack(pc *webrtc.PeerConnection) (*webrtc.TrackLocalStaticSample, error) {
+	if s.naviSize.Width == 0 {
+		return nil, nil
+	}
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeH264,
+		ClockRate:   90000,
+		SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640032",
+	}, "navi", "navi")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pc.AddTransceiverFromTrack(track, webrtc.RtpTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendonly,
+	}); err != nil {
+		return nil, err
+	}
+	return track, nil
+}
+
+// writeVideoSample writes data to track as a sample of a stream at fps.
+func (s *Server) writeVideoSample(track *webrtc.TrackLocalStaticSample, data *protocol.VideoData, fps int32) {
+	duration := time.Duration((float32(1) / float32(fps)) * float32(time.Second))
+
+	// The packetizer keeps a trailing SPS or PPS for the next sample, after
+	// the buffer of this frame has been reused.
+	sample := data.Data
+	if i := bytes.LastIndex(sample, []byte{0, 0, 1}); i >= 0 && i+3 < len(sample) {
+		switch sample[i+3] & 0x1f {
+		case 7, 8:
+			sample = bytes.Clone(sample)
+		}
+	}
+	if err := track.WriteSample(media.Sample{Data: sample, Duration: duration}); err != nil {
+		s.Debug("write video sample", "error", err.Error())
+	}
+}
+
+// audioPacket prefixes the PCM samples of data with their sample rate and
+// channel count, both little endian uint16, as expected by the bundled UI.
+func audioPacket(data *protocol.AudioData) []byte {
+	var buf bytes.Buffer
+	fr := protocol.AudioDecodeTypes[data.DecodeType].Frequency
+	ch := protocol.AudioDecodeTypes[data.DecodeType].Channel
+	binary.Write(&buf, binary.LittleEndian, fr)
+	binary.Write(&buf, binary.LittleEndian, ch)
+	return append(buf.Bytes(), data.Data...)
+}
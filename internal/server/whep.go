@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/protocol"
+	"github.com/pion/webrtc/v3"
+)
+
+// WHEP (WebRTC-HTTP Egress Protocol) lets standard players such as OBS and
+// GStreamer's whepsrc pull the video, and the navigation video when offered a
+// second video track. Audio is not offered as the dongle sends
+// PCM, which WebRTC players cannot receive without transcoding. WHEP players
+// only watch: they start the dongle at the size of WithScreenSize if it is
+// given, and wait for a control session to start it otherwise.
+
+const (
+	contentTypeSDP         = "application/sdp"
+	contentTypeTrickleICE  = "application/trickle-ice-sdpfrag"
+	whepResourcePathPrefix = "/whep/"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrResourceNotFound     = errors.New("resource not found")
+	ErrStreamingUnsupported = errors.New("streaming unsupported")
+)
+
+func (s *Server) whepOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Post", contentTypeSDP)
+	w.Header().Set("Allow", "OPTIONS, POST")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) whepOfferHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasContentType(r, contentTypeSDP) {
+		writeError(w, http.StatusUnsupportedMediaType, ErrUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, answer, err := s.setupWHEP(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(body)})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeSDP)
+	w.Header().Set("Location", whepResourcePathPrefix+id)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, answer.SDP)
+}
+
+func (s *Server) setupWHEP(offer webrtc.SessionDescription) (string, *webrtc.SessionDescription, error) {
+	s.Debug("setup whep")
+
+	pc, videoTrack, err := s.newPeerConnection()
+	if err != nil {
+		return "", nil, err
+	}
+	naviTrack, err := s.addNaviTrack(pc)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	p := newPeer(pc, &session{
+		size: s.size,
+		role: RoleView,
+		onData: func(data any) {
+			switch data := data.(type) {
+			case *protocol.VideoData:
+				s.writeVideoSample(videoTrack, data, s.fps)
+			case *protocol.NaviVideoData:
+				if naviTrack != nil {
+					s.writeVideoSample(naviTrack, (*protocol.VideoData)(data), s.naviFPS)
+				}
+			}
+		},
+	})
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	// Players without trickle ICE need every candidate in the answer.
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+	<-gatherComplete
+
+	id, err := s.register(p)
+	if err != nil {
+		pc.Close()
+		return "", nil, err
+	}
+
+	if s.size.Width != 0 && s.size.Height != 0 {
+		lnk, err := s.dongle()
+		if err == nil {
+			err = s.open(lnk, s.size)
+		}
+		if err != nil {
+			s.closePeer(id)
+			return "", nil, err
+		}
+	}
+
+	return id, pc.LocalDescription(), nil
+}
+
+// whepPatchHandler adds the trickled ICE candidates of an SDP fragment
+// (RFC 8840) to the resource.
+func (s *Server) whepPatchHandler(w http.ResponseWriter, r *http.Request) {
+	p := s.peer(r.PathValue("id"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, ErrResourceNotFound)
+		return
+	}
+	if !hasContentType(r, contentTypeTrickleICE) {
+		writeError(w, http.StatusUnsupportedMediaType, ErrUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var mid string
+	var mLineIndex uint16
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "a=mid:"):
+			mid = strings.TrimPrefix(line, "a=mid:")
+			mLineIndex = p.mLineIndex(mid)
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidate := webrtc.ICECandidateInit{
+				Candidate:     strings.TrimPrefix(line, "a="),
+				SDPMid:        &mid,
+				SDPMLineIndex: &mLineIndex,
+			}
+			if err := p.pc.AddICECandidate(candidate); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) whepDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.closePeer(r.PathValue("id")) {
+		writeError(w, http.StatusNotFound, ErrResourceNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func hasContentType(r *http.Request, contentType string) bool {
+	ct, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	return strings.TrimSpace(ct) == contentType
+}
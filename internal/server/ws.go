@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Kinds of the frames sent to WebSocket clients. Every binary message is a
+// kind byte followed by the little endian uint32 length of the payload and
+// the payload itself.
+const (
+	// wsKindVideo carries one H.264 access unit in Annex-B format.
+	wsKindVideo = 1
+	// wsKindAudio carries PCM samples in the format of audioPacket.
+	wsKindAudio = 2
+	// wsKindControl carries a JSON encoded wsControl.
+	wsKindControl = 3
+)
+
+// Clients send the samples of their microphone as binary messages of 16kHz
+// mono 16 bit little endian PCM, between the "microphone" control messages
+// turning it on and off.
+
+// wsQueueSize is how many frames may be pending for a client before frames are dropped.
+const wsQueueSize = 64
+
+// wsControl is a control message exchanged with WebSocket clients. Clients
+// send it as a text message with the fields of link.ScreenSize for "start",
+// link.ScreenTouch for "touch" and screenKey for "key".
+type wsControl struct {
+	Type      string             `json:"type"`
+	PhoneType protocol.PhoneType `json:"phoneType,omitempty"`
+	Wireless  bool               `json:"wireless,omitempty"`
+	On        bool               `json:"on,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{}
+
+func (s *Server) webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	lnk, err := s.dongle()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.Error("websocket upgrade", "error", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	frames := make(chan []byte, wsQueueSize)
+	done := make(chan struct{})
+	defer close(done)
+
+	push := func(kind byte, payload []byte) {
+		frame := make([]byte, 0, 5+len(payload))
+		frame = append(frame, kind)
+		frame = binary.LittleEndian.AppendUint32(frame, uint32(len(payload)))
+		frame = append(frame, payload...)
+		select {
+		case frames <- frame:
+		case <-done:
+		default:
+			s.Warn("websocket client too slow, dropping frame", "kind", kind)
+		}
+	}
+	pushControl := func(ctrl wsControl) {
+		payload, err := json.Marshal(ctrl)
+		if err != nil {
+			s.Error("marshal control", "error", err.Error())
+			return
+		}
+		push(wsKindControl, payload)
+	}
+
+	sess := &session{
+		role: roleFrom(r.Context()),
+		onData: func(data any) {
+			switch data := data.(type) {
+			case *protocol.VideoData:
+				push(wsKindVideo, data.Data)
+			case *protocol.AudioData:
+				if len(data.Data) > 0 {
+					push(wsKindAudio, audioPacket(data))
+				}
+			case *protocol.Plugged:
+				pushControl(wsControl{Type: "plugged", PhoneType: data.PhoneType, Wireless: data.Wifi})
+			case *protocol.Unplugged:
+				pushControl(wsControl{Type: "unplugged"})
+			}
+		},
+		onMicrophone: func(on bool) {
+			pushControl(wsControl{Type: "microphone", On: on})
+		},
+	}
+	s.attach(sess)
+	defer s.detach(sess)
+
+	go func() {
+		for {
+			select {
+			case frame := <-frames:
+				if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+					s.Debug("websocket write", "error", err.Error())
+					conn.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			s.Debug("websocket read", "error", err.Error())
+			return
+		}
+		if msgType == websocket.BinaryMessage {
+			s.sendMicrophone(lnk, sess, msg)
+			continue
+		}
+		var ctrl wsControl
+		if err := json.Unmarshal(msg, &ctrl); err != nil {
+			s.Error("unmarshal control", "error", err.Error())
+			continue
+		}
+		switch ctrl.Type {
+		case "start":
+			if err := s.startCarPlay(lnk, sess, msg); err != nil {
+				s.Error("start car play", "error", err.Error())
+			}
+		case "touch":
+			s.sendTouch(lnk, sess, msg)
+		case "key":
+			s.sendKey(lnk, sess, msg)
+		default:
+			s.Warn("unknown control message", "type", ctrl.Type)
+		}
+	}
+}
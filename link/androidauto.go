@@ -0,0 +1,84 @@
+package link
+
+import (
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// WorkMode selects the protocol Android phones connect with. iPhones always
+// connect with CarPlay.
+type WorkMode int32
+
+const (
+	WorkModeCarPlay     WorkMode = 0
+	WorkModeAndroidAuto WorkMode = 1
+)
+
+func (m WorkMode) String() string {
+	switch m {
+	case WorkModeCarPlay:
+		return "carplay"
+	case WorkModeAndroidAuto:
+		return "androidauto"
+	}
+	return "unknown"
+}
+
+// ParseWorkMode parses the String of a WorkMode.
+func ParseWorkMode(s string) (WorkMode, error) {
+	switch s {
+	case "carplay":
+		return WorkModeCarPlay, nil
+	case "androidauto":
+		return WorkModeAndroidAuto, nil
+	}
+	return 0, ErrInvalidWorkMode
+}
+
+// androidAutoSizes are the video resolutions of Android Auto, largest first.
+var androidAutoSizes = []ScreenSize{
+	{Width: 1920, Height: 1080},
+	{Width: 1280, Height: 720},
+	{Width: 800, Height: 480},
+}
+
+// AndroidAutoSize returns the largest Android Auto resolution fitting in
+// screen. Android Auto renders only these and the dongle scales them.
+func AndroidAutoSize(screen ScreenSize) ScreenSize {
+	for _, size := range androidAutoSizes {
+		if size.Width <= screen.Width && size.Height <= screen.Height {
+			return size
+		}
+	}
+	return androidAutoSizes[len(androidAutoSizes)-1]
+}
+
+// PhoneType returns the type of the connected phone, or 0 when none is.
+func (l *Link) PhoneType() protocol.PhoneType {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.phoneType
+}
+
+// onPlugged records the type of the connected phone, or that it was
+// unplugged when data is nil, and sets the DPI for Android Auto, restoring the
+// DPI of the link for other phones.
+func (l *Link) onPlugged(data *protocol.Plugged) {
+	var phoneType protocol.PhoneType
+	if data != nil {
+		phoneType = data.PhoneType
+	}
+	l.mu.Lock()
+	l.phoneType = phoneType
+	l.mu.Unlock()
+
+	if l.dongle.AndroidAutoDPI == 0 {
+		return
+	}
+	dpi := l.dpi
+	if phoneType == protocol.PhoneTypeAndroidAuto {
+		dpi = l.dongle.AndroidAutoDPI
+	}
+	if err := l.Send(&protocol.SendFile{FileName: "/tmp/screen_dpi\x00", Content: intToByte(dpi)}); err != nil {
+		l.Error("send screen dpi", "error", err.Error())
+	}
+}
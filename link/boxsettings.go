@@ -0,0 +1,82 @@
+package link
+
+import (
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// BoxSettings returns the settings the dongle last replied with.
+func (l *Link) BoxSettings() (protocol.BoxSettings, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.boxReply == nil {
+		return protocol.BoxSettings{}, false
+	}
+	return *l.boxReply, true
+}
+
+// SendBoxSettings sends settings to the dongle. Until the dongle reports a
+// firmware that accepts them, the box name is written with SendFile and the
+// dongle's microphone is selected with a command instead. The other settings
+// have no such fallback and are dropped with a warning.
+func (l *Link) SendBoxSettings(settings protocol.BoxSettings) error {
+	if caps, _ := l.Capabilities(); caps.BoxSettings {
+		return l.Send(&settings)
+	}
+
+	l.Debug("box settings unsupported, sending files and commands")
+	if settings.BoxName != "" {
+		if err := l.Send(&protocol.SendFile{FileName: "/tmp/box_name\x00", Content: []byte(settings.BoxName)}); err != nil {
+			return err
+		}
+	}
+	if settings.MicType == 1 {
+		if err := l.Send(&protocol.CarPlay{Command: protocol.BoxMicrophone}); err != nil {
+			return err
+		}
+	}
+
+	for _, dropped := range []struct {
+		name string
+		set  bool
+	}{
+		{"media delay", settings.MediaDelay != 0},
+		{"wifi channel", settings.WifiChannel != 0},
+		{"android auto size", settings.AndroidAutoWidth != 0 || settings.AndroidAutoHeight != 0},
+		{"navigation screen", settings.NaviScreen != nil},
+		{"paired devices", settings.Devices != nil},
+	} {
+		if dropped.set {
+			l.Warn("setting not supported by the firmware", "setting", dropped.name)
+		}
+	}
+	return nil
+}
+
+// sendBoxSettings sends the settings of the link as box settings.
+func (l *Link) sendBoxSettings() {
+	settings := protocol.BoxSettings{
+		SyncTime:    time.Now().Unix(),
+		MediaDelay:  l.dongle.MediaDelay,
+		MicType:     l.dongle.MicType,
+		WifiChannel: l.dongle.WifiChannel,
+		BoxName:     l.dongle.BoxName,
+	}
+	if l.dongle.WorkMode == WorkModeAndroidAuto {
+		aaSize := AndroidAutoSize(l.screen())
+		settings.AndroidAutoWidth, settings.AndroidAutoHeight = aaSize.Width, aaSize.Height
+	}
+	if caps, _ := l.Capabilities(); caps.NaviVideo {
+		settings.NaviScreen = l.naviScreen()
+	}
+	if err := l.SendBoxSettings(settings); err != nil {
+		l.Error("send box settings", "error", err.Error())
+	}
+}
+
+func (l *Link) onBoxSettings(data *protocol.BoxSettings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.boxReply = data
+}
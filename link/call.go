@@ -0,0 +1,131 @@
+package link
+
+import (
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// CallEvent is a change of the state of a phone call.
+type CallEvent int
+
+const (
+	// Ringing is an incoming call not answered yet.
+	Ringing CallEvent = iota + 1
+	// CallStarted is a call answered or placed.
+	CallStarted
+	// CallEnded is a call hung up, declined or missed.
+	CallEnded
+)
+
+func (e CallEvent) String() string {
+	switch e {
+	case Ringing:
+		return "ringing"
+	case CallStarted:
+		return "started"
+	case CallEnded:
+		return "ended"
+	}
+	return "unknown"
+}
+
+// CallState is the state of the phone call.
+type CallState int
+
+const (
+	CallIdle CallState = iota
+	CallRinging
+	CallActive
+)
+
+func (s CallState) String() string {
+	switch s {
+	case CallIdle:
+		return "idle"
+	case CallRinging:
+		return "ringing"
+	case CallActive:
+		return "active"
+	}
+	return "unknown"
+}
+
+// CallState returns the state of the phone call.
+func (l *Link) CallState() CallState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.call
+}
+
+// OnCall calls fn with every change of the phone call, until the returned
+// function is called.
+func (l *Link) OnCall(fn func(CallEvent)) (cancel func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.callSubs == nil {
+		l.callSubs = make(map[int]func(CallEvent))
+	}
+	id := l.nextSub
+	l.nextSub++
+	l.callSubs[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.callSubs, id)
+	}
+}
+
+// trackCall follows the phone call from the audio commands of the dongle: the
+// ringtone is an alert played outside of a call, and the call itself starts
+// and stops the phone call audio. A call ends too when the phone is gone.
+func (l *Link) trackCall(data any) {
+	l.mu.Lock()
+	state := l.call
+	switch data := data.(type) {
+	case *protocol.AudioData:
+		switch data.Command {
+		case protocol.AudioAlertStart:
+			if state == CallIdle {
+				state = CallRinging
+			}
+		case protocol.AudioAlertStop:
+			if state == CallRinging {
+				state = CallIdle
+			}
+		case protocol.AudioPhonecallStart:
+			state = CallActive
+		case protocol.AudioPhonecallStop:
+			state = CallIdle
+		}
+	case *protocol.Phase:
+		if data.Phase == protocol.PhaseIdle {
+			state = CallIdle
+		}
+	case *protocol.Unplugged:
+		state = CallIdle
+	}
+	if state == l.call {
+		l.mu.Unlock()
+		return
+	}
+	l.call = state
+
+	var event CallEvent
+	switch state {
+	case CallRinging:
+		event = Ringing
+	case CallActive:
+		event = CallStarted
+	case CallIdle:
+		event = CallEnded
+	}
+	subs := make([]func(CallEvent), 0, len(l.callSubs))
+	for _, fn := range l.callSubs {
+		subs = append(subs, fn)
+	}
+	l.mu.Unlock()
+
+	l.Debug("call", "event", event.String())
+	for _, fn := range subs {
+		fn(event)
+	}
+}
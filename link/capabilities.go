@@ -0,0 +1,57 @@
+package link
+
+import (
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// SoftwareVersion returns the firmware version of the dongle, once received.
+func (l *Link) SoftwareVersion() (Version, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.version, l.hasVersion
+}
+
+// Capabilities returns the capabilities of the dongle, which are known once
+// it has reported its firmware version.
+func (l *Link) Capabilities() (Capabilities, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	caps := CapabilitiesOf(l.version)
+	caps.WirelessCarPlay = l.wireless
+	return caps, l.hasVersion
+}
+
+// onSoftwareVersion records the firmware version and sends what depends on it.
+func (l *Link) onSoftwareVersion(data *protocol.SoftwareVersion) {
+	version, err := ParseVersion(string(data.Version))
+	if err != nil {
+		l.Warn("parse software version", "error", err.Error())
+		return
+	}
+	l.mu.Lock()
+	l.version, l.hasVersion = version, true
+	l.mu.Unlock()
+	l.Info("dongle firmware", "version", version.String())
+
+	caps, _ := l.Capabilities()
+	l.sendBoxSettings()
+	if l.naviScreen() != nil && !caps.NaviVideo {
+		l.Warn("navigation video is not known to be supported by the firmware", "version", version.String())
+	}
+	if l.dongle.WorkMode == WorkModeAndroidAuto && !caps.AndroidAuto {
+		l.Warn("android auto is not known to be supported by the firmware", "version", version.String())
+	}
+}
+
+// onCarPlay records the capabilities the dongle reports with commands.
+func (l *Link) onCarPlay(data *protocol.CarPlay) {
+	switch data.Command {
+	case protocol.SupportWifi, protocol.SupportWifiNeedKo:
+		l.mu.Lock()
+		l.wireless = true
+		l.mu.Unlock()
+		if l.dongle.Wireless {
+			l.connectWifi()
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/mzyy94/gocarplay/protocol"
@@ -25,6 +26,47 @@ type ScreenSize struct {
 	Height int32 `json:"height"`
 }
 
+// DongleConfig holds the settings written to the dongle when the link is created.
+type DongleConfig struct {
+	// NightMode is 0 for day, 1 for night and 2 to follow the phone.
+	NightMode int32 `json:"nightMode"`
+	// HandDriveMode is 0 for left hand drive and 1 for right hand drive.
+	HandDriveMode int32 `json:"handDriveMode"`
+	// ChargeMode is 0 for slow and 1 for fast charging of the phone.
+	ChargeMode int32 `json:"chargeMode"`
+	// BoxName is the name the dongle advertises to phones.
+	BoxName string `json:"boxName"`
+	// MediaDelay is the audio buffering of the dongle in milliseconds, 0 for
+	// the default of the firmware. It is set only on firmwares accepting box settings.
+	MediaDelay int32 `json:"mediaDelay"`
+	// MicType selects the microphone: 0 for the head unit's, 1 for the
+	// dongle's.
+	MicType int32 `json:"micType"`
+	// Wireless enables wireless CarPlay on dongles supporting it.
+	Wireless bool `json:"wireless"`
+	// WifiBand is the band of the access point of the dongle for wireless CarPlay.
+	WifiBand WifiBand `json:"wifiBand"`
+	// WifiChannel is the channel of the access point, 0 for the default of the
+	// firmware. It is set only on firmwares accepting box settings.
+	WifiChannel int32 `json:"wifiChannel"`
+	// WorkMode selects whether Android phones connect with Android Auto.
+	// Android Auto renders at the AndroidAutoSize of the screen on firmwares
+	// accepting box settings, and at the default of older firmwares.
+	WorkMode WorkMode `json:"workMode"`
+	// AndroidAutoDPI is the DPI Android Auto renders at, 0 for the DPI of the link.
+	AndroidAutoDPI int32 `json:"androidAutoDPI"`
+}
+
+// DefaultDongleConfig is the DongleConfig used unless WithDongleConfig is given.
+var DefaultDongleConfig = DongleConfig{
+	NightMode:     1,
+	HandDriveMode: 1,
+	ChargeMode:    0,
+	BoxName:       "BoxName",
+	Wireless:      true,
+	WifiBand:      WifiBand5GHz,
+}
+
 type Logger interface {
 	Debug(msg string, args ...any)
 	Info(msg string, args ...any)
@@ -41,10 +83,35 @@ type Link struct {
 	dpi        int32
 	logger     Logger
 	cancel     context.CancelFunc
+	dongle     DongleConfig
+
+	// sendMu serializes Send, whose header and payload are written apart.
+	sendMu sync.Mutex
+
+	mu        sync.Mutex
+	mediaSubs map[int]func(any)
+	nextSub   int
+	boxReply  *protocol.BoxSettings
+
+	version    Version
+	hasVersion bool
+	wireless   bool
+	phoneType  protocol.PhoneType
+	navi       *protocol.NaviScreenInfo
+	call       CallState
+	callSubs   map[int]func(CallEvent)
+
+	mic          bool
+	micSubs      map[int]func(bool)
+	siriPressed  time.Time
+	siriReleased bool
+
+	pairing *Pairing
 }
 
 func New(opts ...Option) (*Link, error) {
-	l := &Link{}
+	l := &Link{dongle: DefaultDongleConfig}
+	l.pairing = &Pairing{l: l}
 	for _, opt := range opts {
 		if err := opt.apply(l); err != nil {
 			return nil, err
@@ -58,13 +125,15 @@ func New(opts ...Option) (*Link, error) {
 	l.ctx, l.cancel = context.WithCancel(l.ctx)
 
 	l.Send(&protocol.SendFile{FileName: "/tmp/screen_dpi\x00", Content: intToByte(l.dpi)})
-	// l.Send(&protocol.Open{Width: l.screenSize.Width, Height: l.screenSize.Height, VideoFrameRate: l.fps, Format: 5, PacketMax: 4915200, IBoxVersion: 2, PhoneWorkMode: 2})
 
 	l.Send(&protocol.ManufacturerInfo{A: 0, B: 0})
-	l.Send(&protocol.SendFile{FileName: "/tmp/night_mode\x00", Content: intToByte(1)})
-	l.Send(&protocol.SendFile{FileName: "/tmp/hand_drive_mode\x00", Content: intToByte(1)})
-	l.Send(&protocol.SendFile{FileName: "/tmp/charge_mode\x00", Content: intToByte(0)})
-	l.Send(&protocol.SendFile{FileName: "/tmp/box_name\x00", Content: bytes.NewBufferString("BoxName").Bytes()})
+	l.Send(&protocol.SendFile{FileName: "/tmp/night_mode\x00", Content: intToByte(l.dongle.NightMode)})
+	l.Send(&protocol.SendFile{FileName: "/tmp/hand_drive_mode\x00", Content: intToByte(l.dongle.HandDriveMode)})
+	l.Send(&protocol.SendFile{FileName: "/tmp/charge_mode\x00", Content: intToByte(l.dongle.ChargeMode)})
+	l.Send(&protocol.SendFile{FileName: "/tmp/box_name\x00", Content: bytes.NewBufferString(l.dongle.BoxName).Bytes()})
+	// The work mode of Android phones is selected by this file, not by
+	// Open.PhoneWorkMode, see SetScreenSize.
+	l.Send(&protocol.SendFile{FileName: "/etc/android_work_mode\x00", Content: intToByte(int32(l.dongle.WorkMode))})
 
 	eg, _ := errgroup.WithContext(l.ctx)
 	eg.Go(func() error {
@@ -124,12 +193,30 @@ func (l *Link) Error(msg string, args ...any) {
 }
 
 func (l *Link) SetScreenSize(screenSize ScreenSize) error {
+	l.mu.Lock()
 	l.screenSize = screenSize
+	l.mu.Unlock()
 	if l.fps == 0 {
 		return errors.New("empty fps")
 	}
-	return l.Send(&protocol.Open{Width: l.screenSize.Width, Height: l.screenSize.Height, VideoFrameRate: l.fps, Format: 5, PacketMax: 4915200, IBoxVersion: 2, PhoneWorkMode: 2})
+	// PhoneWorkMode is 2 whatever the WorkMode, as pycarplay and node-carplay
+	// send it: its other values are undocumented, and Android Auto is
+	// switched on by /etc/android_work_mode instead.
+	if err := l.Send(&protocol.Open{Width: screenSize.Width, Height: screenSize.Height, VideoFrameRate: l.fps, Format: 5, PacketMax: 4915200, IBoxVersion: 2, PhoneWorkMode: 2}); err != nil {
+		return err
+	}
+	if l.dongle.Wireless {
+		return l.enableWifi()
+	}
+	return nil
+}
 
+// screen returns the screen size last set, which SetScreenSize changes while
+// the link communicates.
+func (l *Link) screen() ScreenSize {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.screenSize
 }
 
 // var epIn io.Reader = &gousb.InEndpoint{}
@@ -169,22 +256,43 @@ func (l *Link) heartBeat() error {
 }
 
 func (l *Link) Communicate(onData func(any)) error {
-	if l.screenSize.Height == 0 && l.screenSize.Width == 0 {
+	if size := l.screen(); size.Height == 0 && size.Width == 0 {
 		return ErrEmptyScreenSize
 	}
 	for {
-		received, err := ReceiveMessage(l.i, l.ctx)
+		msg, err := ReceiveMessage(l.i, l.ctx)
 		if err != nil {
 			slog.Error("recieve message", "error", err.Error())
 		} else {
+			// Media is handed on decoded, which is not a message.
+			var received any = msg
+			l.pairing.update(received)
+			l.trackCall(received)
+			l.trackMicrophone(received)
+			switch data := received.(type) {
+			case *protocol.MediaData:
+				received = l.decodeMedia(data)
+			case *protocol.SoftwareVersion:
+				l.onSoftwareVersion(data)
+			case *protocol.BoxSettings:
+				l.onBoxSettings(data)
+			case *protocol.CarPlay:
+				l.onCarPlay(data)
+			case *protocol.Plugged:
+				l.onPlugged(data)
+			case *protocol.Unplugged:
+				l.onPlugged(nil)
+			}
 			onData(received)
 		}
 	}
 }
 
-func (l *Link) Send(data interface{}) error {
+func (l *Link) Send(data protocol.Message) error {
 	if l.o == nil {
 		return ErrNotConnected
 	}
+	l.sendMu.Lock()
+	defer l.sendMu.Unlock()
 	return SendMessage(l.o, data)
 }
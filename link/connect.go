@@ -9,7 +9,18 @@ import (
 	"github.com/google/gousb"
 )
 
+// USB IDs of the Carlinkit dongle.
+const (
+	DefaultVendorID  gousb.ID = 0x1314
+	DefaultProductID gousb.ID = 0x1520
+)
+
 func Connect(ctx context.Context) (*gousb.InEndpoint, *gousb.OutEndpoint, error) {
+	return ConnectDevice(ctx, DefaultVendorID, DefaultProductID)
+}
+
+// ConnectDevice connects to the dongle with the given USB vendor and product ID.
+func ConnectDevice(ctx context.Context, vid, pid gousb.ID) (*gousb.InEndpoint, *gousb.OutEndpoint, error) {
 	cleanTask := make([]func() error, 0)
 
 	usbctx := gousb.NewContext()
@@ -23,7 +34,7 @@ func Connect(ctx context.Context) (*gousb.InEndpoint, *gousb.OutEndpoint, error)
 	)
 
 	for {
-		dev, err = usbctx.OpenDeviceWithVIDPID(0x1314, 0x1520)
+		dev, err = usbctx.OpenDeviceWithVIDPID(vid, pid)
 		if err != nil {
 			return nil, nil, err
 		}
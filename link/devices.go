@@ -0,0 +1,70 @@
+package link
+
+import (
+	"github.com/google/gousb"
+)
+
+// USBID is the USB vendor and product ID of a dongle model.
+type USBID struct {
+	Vendor  gousb.ID
+	Product gousb.ID
+}
+
+// KnownDevices are the USB IDs of the supported Carlinkit dongles.
+var KnownDevices = []USBID{
+	{DefaultVendorID, DefaultProductID},
+	{DefaultVendorID, 0x1521},
+}
+
+// Device describes a dongle attached over USB.
+type Device struct {
+	Bus          int
+	Address      int
+	ID           USBID
+	Manufacturer string
+	Product      string
+	Serial       string
+}
+
+// Devices lists the attached dongles with any of ids, or with any of
+// KnownDevices when no ids are given.
+func Devices(ids ...USBID) ([]Device, error) {
+	if len(ids) == 0 {
+		ids = KnownDevices
+	}
+
+	usbctx := gousb.NewContext()
+	defer usbctx.Close()
+
+	devs, err := usbctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		for _, id := range ids {
+			if desc.Vendor == id.Vendor && desc.Product == id.Product {
+				return true
+			}
+		}
+		return false
+	})
+	defer func() {
+		for _, dev := range devs {
+			dev.Close()
+		}
+	}()
+	if err != nil && len(devs) == 0 {
+		return nil, err
+	}
+
+	devices := make([]Device, 0, len(devs))
+	for _, dev := range devs {
+		d := Device{
+			Bus:     dev.Desc.Bus,
+			Address: dev.Desc.Address,
+			ID:      USBID{dev.Desc.Vendor, dev.Desc.Product},
+		}
+		// The strings are informational and may be unreadable without permission.
+		d.Manufacturer, _ = dev.Manufacturer()
+		d.Product, _ = dev.Product()
+		d.Serial, _ = dev.SerialNumber()
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
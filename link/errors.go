@@ -10,4 +10,9 @@ var (
 	ErrEmptyInput      = errors.New("empty input")
 	ErrEmptyOutput     = errors.New("empty output")
 	ErrEmptyScreenSize = errors.New("empty screen size")
+	ErrInvalidVersion  = errors.New("invalid version")
+	ErrUnsupported     = errors.New("unsupported by the dongle firmware")
+	ErrUnknownDevice   = errors.New("unknown device")
+	ErrInvalidWifiBand = errors.New("invalid wifi band")
+	ErrInvalidWorkMode = errors.New("invalid work mode")
 )
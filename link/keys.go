@@ -0,0 +1,87 @@
+package link
+
+import (
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Key is a button of the head unit, such as a steering wheel button, sent
+// as the command of the connected phone.
+type Key string
+
+const (
+	KeyBack   Key = "back"
+	KeyHome   Key = "home"
+	KeyLeft   Key = "left"
+	KeyRight  Key = "right"
+	KeySelect Key = "select"
+	KeyUp     Key = "up"
+	KeyDown   Key = "down"
+	KeyPlay   Key = "play"
+	KeyPause  Key = "pause"
+	KeyNext   Key = "next"
+	KeyPrev   Key = "prev"
+	KeyVoice  Key = "voice"
+)
+
+// keyCommands are the commands sent when a key is pressed and released.
+type keyCommands struct {
+	press, release protocol.CarPlayType
+}
+
+var carPlayKeys = map[Key]keyCommands{
+	KeyBack:   {press: protocol.BtnBack},
+	KeyHome:   {press: protocol.BtnHome},
+	KeyLeft:   {press: protocol.BtnLeft},
+	KeyRight:  {press: protocol.BtnRight},
+	KeySelect: {press: protocol.BtnSelectDown, release: protocol.BtnSelectUp},
+	KeyDown:   {press: protocol.BtnDown},
+	KeyPlay:   {press: protocol.BtnPlay},
+	KeyPause:  {press: protocol.BtnPause},
+	KeyNext:   {press: protocol.BtnNextTrack},
+	KeyPrev:   {press: protocol.BtnPrevTrack},
+}
+
+// androidAutoKeys drive the rotary controller of Android Auto: left and right
+// turn the knob, select presses it, held for a long press, and up and down
+// nudge it. CarPlay has no up nudge.
+var androidAutoKeys = map[Key]keyCommands{
+	KeyBack:   {press: protocol.BtnBack},
+	KeyHome:   {press: protocol.BtnHome},
+	KeyLeft:   {press: protocol.BtnLeft},
+	KeyRight:  {press: protocol.BtnRight},
+	KeySelect: {press: protocol.BtnSelectDown, release: protocol.BtnSelectUp},
+	KeyUp:     {press: protocol.BtnUp},
+	KeyDown:   {press: protocol.BtnDown},
+	KeyPlay:   {press: protocol.BtnPlay},
+	KeyPause:  {press: protocol.BtnPause},
+	KeyNext:   {press: protocol.BtnNextTrack},
+	KeyPrev:   {press: protocol.BtnPrevTrack},
+}
+
+// SendKey sends the command of key for the connected phone, on press or on
+// release. Keys without a command on the phone or on release are ignored.
+// The voice key is held down for push-to-talk, see StartSiri.
+func (l *Link) SendKey(key Key, pressed bool) error {
+	if key == KeyVoice {
+		if pressed {
+			return l.StartSiri()
+		}
+		return l.StopSiri()
+	}
+	keys := carPlayKeys
+	if l.PhoneType() == protocol.PhoneTypeAndroidAuto {
+		keys = androidAutoKeys
+	}
+	cmds, ok := keys[key]
+	if !ok {
+		return nil
+	}
+	cmd := cmds.press
+	if !pressed {
+		cmd = cmds.release
+	}
+	if cmd == protocol.Invalid {
+		return nil
+	}
+	return l.Send(&protocol.CarPlay{Command: cmd})
+}
@@ -0,0 +1,48 @@
+package link
+
+import (
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// OnMedia calls fn with every *protocol.MediaInfo and *protocol.AlbumArt
+// received by Communicate, until the returned function is called.
+func (l *Link) OnMedia(fn func(media any)) (cancel func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.mediaSubs == nil {
+		l.mediaSubs = make(map[int]func(any))
+	}
+	id := l.nextSub
+	l.nextSub++
+	l.mediaSubs[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.mediaSubs, id)
+	}
+}
+
+// decodeMedia decodes data into its typed message and hands it to the
+// subscribers of OnMedia.
+func (l *Link) decodeMedia(data *protocol.MediaData) any {
+	media, err := data.Decode()
+	if err != nil {
+		l.Warn("decode media", "type", data.MediaType, "error", err.Error())
+		return data
+	}
+	if _, ok := media.(*protocol.MediaData); ok {
+		return data
+	}
+
+	l.mu.Lock()
+	subs := make([]func(any), 0, len(l.mediaSubs))
+	for _, fn := range l.mediaSubs {
+		subs = append(subs, fn)
+	}
+	l.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(media)
+	}
+	return media
+}
@@ -0,0 +1,30 @@
+package link
+
+import (
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// EnableNaviVideo asks the dongle to send the navigation video, as
+// protocol.NaviVideoData, at size and fps. Until the dongle has reported its
+// firmware, the request is held and sent along with the box settings.
+func (l *Link) EnableNaviVideo(size ScreenSize, fps int32) error {
+	l.mu.Lock()
+	l.navi = &protocol.NaviScreenInfo{Width: size.Width, Height: size.Height, FPS: fps}
+	l.mu.Unlock()
+
+	caps, known := l.Capabilities()
+	switch {
+	case !known:
+		return nil
+	case !caps.NaviVideo:
+		return ErrUnsupported
+	}
+	return l.Send(&protocol.BoxSettings{NaviScreen: l.naviScreen()})
+}
+
+// naviScreen returns the requested navigation screen, if any.
+func (l *Link) naviScreen() *protocol.NaviScreenInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.navi
+}
@@ -63,3 +63,13 @@ func WithLogger(logger Logger) Option {
 		return nil
 	})
 }
+
+func WithDongleConfig(cfg DongleConfig) Option {
+	return applyOptionFunc(func(l *Link) error {
+		if _, err := cfg.WifiBand.command(); err != nil {
+			return err
+		}
+		l.dongle = cfg
+		return nil
+	})
+}
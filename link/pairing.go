@@ -0,0 +1,173 @@
+package link
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Identity is how the dongle presents itself to phones.
+type Identity struct {
+	BluetoothAddress string `json:"bluetoothAddress"`
+	BluetoothPIN     string `json:"bluetoothPIN,omitempty"`
+	BluetoothName    string `json:"bluetoothName"`
+	WifiName         string `json:"wifiName"`
+}
+
+// PairedDevice is a phone paired with the dongle.
+type PairedDevice struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+}
+
+// Pairing keeps the identity of the dongle and the phones paired with it, as
+// reported by the dongle.
+type Pairing struct {
+	l *Link
+
+	mu       sync.Mutex
+	identity Identity
+	paired   []PairedDevice
+	// devices are the phones of the last BoxSettings from the dongle, which
+	// unlike paired keep their type.
+	devices []protocol.BoxDevice
+	// connected is the Bluetooth address of the connected phone.
+	connected string
+}
+
+// Pairing returns the pairing state of the dongle.
+func (l *Link) Pairing() *Pairing {
+	return l.pairing
+}
+
+// Identity returns how the dongle presents itself to phones.
+func (p *Pairing) Identity() Identity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.identity
+}
+
+// Paired returns the phones paired with the dongle.
+func (p *Pairing) Paired() []PairedDevice {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PairedDevice(nil), p.paired...)
+}
+
+// Connected returns the Bluetooth address of the connected phone, if any.
+func (p *Pairing) Connected() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connected
+}
+
+// Forget removes the phone with address from the dongle, disconnecting it
+// first if it is connected. Only firmwares accepting box settings can forget
+// a single phone.
+func (p *Pairing) Forget(address string) error {
+	if caps, _ := p.l.Capabilities(); !caps.BoxSettings {
+		return ErrUnsupported
+	}
+
+	p.mu.Lock()
+	known := p.devices
+	if known == nil {
+		// The dongle did not list its phones in box settings yet, so their
+		// types are not known.
+		for _, d := range p.paired {
+			known = append(known, protocol.BoxDevice{ID: d.Address, Name: d.Name})
+		}
+	}
+	found := false
+	devices := []protocol.BoxDevice{}
+	for _, d := range known {
+		if strings.EqualFold(d.ID, address) {
+			found = true
+			continue
+		}
+		devices = append(devices, d)
+	}
+	connected := strings.EqualFold(p.connected, address)
+	p.mu.Unlock()
+	if !found {
+		return ErrUnknownDevice
+	}
+
+	if connected {
+		if err := p.l.Send(&protocol.DisconnectPhone{}); err != nil {
+			return err
+		}
+	}
+	if err := p.l.Send(&protocol.BoxSettings{Devices: &devices}); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setDevices(devices)
+	return nil
+}
+
+// ConnectLast asks the dongle to connect to the phone connected last.
+func (p *Pairing) ConnectLast() error {
+	return p.l.Send(&protocol.CarPlay{Command: protocol.WifiConnect})
+}
+
+// update applies data received from the dongle.
+func (p *Pairing) update(data any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch data := data.(type) {
+	case *protocol.BluetoothAddress:
+		p.identity.BluetoothAddress = trimNull(data.Address)
+	case *protocol.BluetoothPIN:
+		p.identity.BluetoothPIN = trimNull(data.Address)
+	case *protocol.BluetoothDeviceName:
+		p.identity.BluetoothName = trimNull(data.Data)
+	case *protocol.WifiDeviceName:
+		p.identity.WifiName = trimNull(data.Data)
+	case *protocol.BluetoothPairedList:
+		p.paired = ParsePairedList(string(data.Data))
+	case *protocol.PeerBluetoothAddress:
+		p.connected = trimNull(data.Address)
+	case *protocol.Unplugged:
+		p.connected = ""
+	case *protocol.BoxSettings:
+		if data.Devices != nil {
+			p.setDevices(*data.Devices)
+		}
+	}
+}
+
+// setDevices replaces the paired phones with devices. p.mu must be held.
+func (p *Pairing) setDevices(devices []protocol.BoxDevice) {
+	p.devices = append([]protocol.BoxDevice{}, devices...)
+	p.paired = p.paired[:0]
+	for _, d := range devices {
+		p.paired = append(p.paired, PairedDevice{Address: d.ID, Name: d.Name})
+	}
+}
+
+// ParsePairedList parses the list of protocol.BluetoothPairedList, a line for
+// every phone with its Bluetooth address followed by its name.
+func ParsePairedList(list string) []PairedDevice {
+	const addressLen = len("00:00:00:00:00:00")
+
+	var devices []PairedDevice
+	for _, line := range strings.Split(strings.TrimRight(list, "\x00"), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < addressLen || strings.Count(line[:addressLen], ":") != 5 {
+			continue
+		}
+		devices = append(devices, PairedDevice{
+			Address: line[:addressLen],
+			Name:    strings.TrimSpace(line[addressLen:]),
+		})
+	}
+	return devices
+}
+
+func trimNull(s protocol.NullTermString) string {
+	return strings.TrimRight(string(s), "\x00")
+}
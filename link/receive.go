@@ -3,31 +3,68 @@ package link
 import (
 	"context"
 	"io"
+	"sync"
 
 	"github.com/mzyy94/gocarplay/protocol"
 )
 
-func ReceiveMessage(r io.Reader, ctx context.Context) (interface{}, error) {
-	buf := make([]byte, 16)
+// headerPool holds the buffers headers are read into.
+var headerPool = sync.Pool{
+	New: func() any { return new([16]byte) },
+}
+
+// ReceiveMessage reads the next message from r. Video frames are read into
+// pooled buffers, which their Release returns once they have been handled.
+// A header or payload cut short is io.ErrUnexpectedEOF.
+func ReceiveMessage(r io.Reader, ctx context.Context) (protocol.Message, error) {
+	hdrBuf := headerPool.Get().(*[16]byte)
+	defer headerPool.Put(hdrBuf)
 	var hdr protocol.Header
-	num, err := r.Read(buf)
-	if err != nil || num != len(buf) {
+	num, err := r.Read(hdrBuf[:])
+	if err != nil {
 		return nil, err
 	}
-	err = protocol.Unmarshal(buf[:num], &hdr)
+	if num != len(hdrBuf) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	err = protocol.Unmarshal(hdrBuf[:], &hdr)
 	if err != nil {
 		return nil, err
 	}
 
 	payload := protocol.GetPayloadByHeader(hdr)
-	buf = make([]byte, hdr.Length)
+	var buf *[]byte
+	pooled := false
+	switch payload.(type) {
+	case *protocol.VideoData, *protocol.NaviVideoData:
+		buf = protocol.AcquireBuffer(int(hdr.Length))
+		pooled = true
+	default:
+		data := make([]byte, hdr.Length)
+		buf = &data
+	}
 
 	if hdr.Length > 0 {
-		num, err = r.Read(buf)
-		if err != nil || num != len(buf) {
+		num, err = r.Read(*buf)
+		if err == nil && num != len(*buf) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			releaseUnused(buf, pooled)
 			return nil, err
 		}
 	}
-	err = protocol.Unmarshal(buf, payload)
-	return payload, err
+	if err := protocol.UnmarshalPooled(buf, payload); err != nil {
+		releaseUnused(buf, pooled)
+		return nil, err
+	}
+	return payload, nil
+}
+
+// releaseUnused returns buf to the pool when it is pooled, for a frame that
+// failed to be received.
+func releaseUnused(buf *[]byte, pooled bool) {
+	if pooled {
+		protocol.ReleaseBuffer(buf)
+	}
 }
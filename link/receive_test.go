@@ -0,0 +1,156 @@
+package link
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/lunixbochs/struc"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// frameReader reads the same encoded message over and over, a header and a
+// payload per Read as the USB endpoint does.
+type frameReader struct {
+	frame []byte
+	off   int
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	n := copy(p, r.frame[r.off:])
+	r.off += n
+	if r.off == len(r.frame) {
+		r.off = 0
+	}
+	return n, nil
+}
+
+func videoFrame(b *testing.B) []byte {
+	data := bytes.Repeat([]byte{0xab}, 64*1024)
+	copy(data, []byte{0, 0, 0, 1, 0x65})
+	frame, err := protocol.Marshal(&protocol.VideoData{Width: 1280, Height: 720, Data: data})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return frame
+}
+
+// receiveUnpooled receives a message as ReceiveMessage did before pooling and
+// the generated codec: into a fresh header and payload, decoded by reflection.
+func receiveUnpooled(r io.Reader) (any, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	var hdr protocol.Header
+	if err := struc.Unpack(bytes.NewReader(buf), &hdr); err != nil {
+		return nil, err
+	}
+	payload := protocol.GetPayloadByHeader(hdr)
+	buf = make([]byte, hdr.Length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if err := struc.Unpack(bytes.NewReader(buf), payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// BenchmarkReceiveVideo reports the allocations per received frame, with the
+// frames released as the server does and received as before pooling.
+func BenchmarkReceiveVideo(b *testing.B) {
+	b.Run("pooled", func(b *testing.B) {
+		r := &frameReader{frame: videoFrame(b)}
+		ctx := context.Background()
+		b.ReportAllocs()
+		b.SetBytes(int64(len(r.frame)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			msg, err := ReceiveMessage(r, ctx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			msg.(*protocol.VideoData).Release()
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		r := &frameReader{frame: videoFrame(b)}
+		b.ReportAllocs()
+		b.SetBytes(int64(len(r.frame)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := receiveUnpooled(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// FuzzReceiveMessage reads messages from an arbitrary stream until it fails,
+// which must happen without panicking or allocating what a corrupt header
+// announces.
+func FuzzReceiveMessage(f *testing.F) {
+	for _, msg := range []protocol.Message{
+		&protocol.Plugged{PhoneType: protocol.PhoneTypeCarPlay, Wifi: true},
+		&protocol.VideoData{Width: 1280, Height: 720, Data: []byte{0, 0, 0, 1, 0x65}},
+		&protocol.AudioData{DecodeType: 2, AudioType: 1, Command: protocol.AudioSiriStart},
+		&protocol.BoxSettings{BoxName: "MyCar"},
+	} {
+		frame, err := protocol.Marshal(msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(frame)
+	}
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		r := bytes.NewReader(stream)
+		ctx := context.Background()
+		for r.Len() > 0 {
+			msg, err := ReceiveMessage(r, ctx)
+			if err != nil || msg == nil {
+				return
+			}
+			if video, ok := msg.(*protocol.VideoData); ok {
+				video.Release()
+			}
+		}
+	})
+}
+
+func TestReceiveMessageHostileLength(t *testing.T) {
+	hdr := binary.LittleEndian.AppendUint32(nil, 0x55aa55aa)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 0xffffffff)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 0x06)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 0x06^0xffffffff)
+
+	r := bytes.NewReader(nil)
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Reset(hdr)
+		if _, err := ReceiveMessage(r, context.Background()); err == nil {
+			t.Errorf("header announcing %d bytes accepted", uint32(0xffffffff))
+		}
+	})
+	if allocs > 2 {
+		t.Errorf("%v allocations reading a hostile header, want at most 2", allocs)
+	}
+}
+
+func TestReceiveMessageShortRead(t *testing.T) {
+	frame, err := protocol.Marshal(&protocol.VideoData{Width: 1280, Height: 720, Data: []byte{0, 0, 0, 1, 0x65}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, r := range map[string]io.Reader{
+		"header":  bytes.NewReader(frame[:8]),
+		"payload": io.MultiReader(bytes.NewReader(frame[:16]), bytes.NewReader(frame[16:len(frame)-1])),
+	} {
+		msg, err := ReceiveMessage(r, context.Background())
+		if msg != nil || err != io.ErrUnexpectedEOF {
+			t.Errorf("short %s: got %v, %v, want io.ErrUnexpectedEOF", name, msg, err)
+		}
+	}
+}
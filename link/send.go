@@ -6,7 +6,9 @@ import (
 	"github.com/mzyy94/gocarplay/protocol"
 )
 
-func SendMessage(epOut io.Writer, msg interface{}) error {
+// SendMessage writes msg to epOut, its header and its payload in two writes.
+// Callers sending from several goroutines must serialize their calls.
+func SendMessage(epOut io.Writer, msg protocol.Message) error {
 	buf, err := protocol.Marshal(msg)
 	if err != nil {
 		return err
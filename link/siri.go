@@ -0,0 +1,140 @@
+package link
+
+import (
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// siriHoldTime is how long the voice button is held down for push-to-talk,
+// rather than tapped.
+const siriHoldTime = 500 * time.Millisecond
+
+// The microphone is sent as 16kHz mono PCM, the format of DecodeType 5.
+const (
+	micDecodeType = protocol.DecodeType(5)
+	micAudioType  = int32(3)
+)
+
+// StartSiri presses the voice button, which starts Siri on the phone, or the
+// voice assistant of Android Auto. The microphone is turned on when the phone
+// starts listening.
+func (l *Link) StartSiri() error {
+	l.mu.Lock()
+	l.siriPressed = time.Now()
+	l.siriReleased = false
+	l.mu.Unlock()
+	return l.Send(&protocol.CarPlay{Command: protocol.BtnSiri})
+}
+
+// StopSiri releases the voice button. When it was held down for push-to-talk,
+// the microphone is turned off so that Siri answers what was said. After a
+// tap, Siri listens until the phone stops it.
+func (l *Link) StopSiri() error {
+	l.mu.Lock()
+	held := !l.siriPressed.IsZero() && time.Since(l.siriPressed) >= siriHoldTime
+	l.siriPressed = time.Time{}
+	if !held {
+		l.mu.Unlock()
+		return nil
+	}
+	l.siriReleased = true
+	if l.call == CallActive {
+		l.mu.Unlock()
+		return nil
+	}
+	l.setMicrophone(false)
+	return nil
+}
+
+// Microphone reports whether the phone is listening to the microphone of the
+// head unit, which is then sent with SendMicrophone.
+func (l *Link) Microphone() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mic
+}
+
+// OnMicrophone calls fn whenever the microphone is turned on or off, until
+// the returned function is called.
+func (l *Link) OnMicrophone(fn func(on bool)) (cancel func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.micSubs == nil {
+		l.micSubs = make(map[int]func(bool))
+	}
+	id := l.nextSub
+	l.nextSub++
+	l.micSubs[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.micSubs, id)
+	}
+}
+
+// SendMicrophone sends 16kHz mono 16 bit little endian PCM samples recorded
+// by the microphone of the head unit. Samples are dropped while the
+// microphone is off.
+func (l *Link) SendMicrophone(pcm []byte) error {
+	if !l.Microphone() {
+		return nil
+	}
+	return l.Send(&protocol.AudioData{DecodeType: micDecodeType, AudioType: micAudioType, Data: pcm})
+}
+
+// trackMicrophone turns the microphone on and off as the dongle asks for it,
+// for Siri and for phone calls. The microphone of the dongle, selected by
+// DongleConfig.MicType, records by itself.
+func (l *Link) trackMicrophone(data any) {
+	if l.dongle.MicType == 1 {
+		return
+	}
+	l.mu.Lock()
+	on := l.mic
+	switch data := data.(type) {
+	case *protocol.CarPlay:
+		switch data.Command {
+		case protocol.StartRecordAudio:
+			on = !l.siriReleased || l.call == CallActive
+		case protocol.StopRecordAudio:
+			on = false
+		}
+	case *protocol.AudioData:
+		switch data.Command {
+		case protocol.AudioSiriStart:
+			on = !l.siriReleased
+		case protocol.AudioSiriStop:
+			l.siriReleased = false
+			on = l.call == CallActive
+		case protocol.AudioPhonecallStart:
+			on = true
+		case protocol.AudioPhonecallStop:
+			on = false
+		}
+	case *protocol.Unplugged:
+		l.siriReleased = false
+		on = false
+	}
+	l.setMicrophone(on)
+}
+
+// setMicrophone turns the microphone on or off and tells the subscribers of
+// OnMicrophone. It is called with l.mu held, which it unlocks.
+func (l *Link) setMicrophone(on bool) {
+	if on == l.mic {
+		l.mu.Unlock()
+		return
+	}
+	l.mic = on
+	subs := make([]func(bool), 0, len(l.micSubs))
+	for _, fn := range l.micSubs {
+		subs = append(subs, fn)
+	}
+	l.mu.Unlock()
+
+	l.Debug("microphone", "on", on)
+	for _, fn := range subs {
+		fn(on)
+	}
+}
@@ -0,0 +1,27 @@
+package link
+
+import "github.com/mzyy94/gocarplay/protocol"
+
+// multiTouchActions maps the actions of protocol.Touch to those of
+// protocol.TouchPoint.
+var multiTouchActions = map[protocol.TouchAction]int32{
+	protocol.TouchUp:   0,
+	protocol.TouchDown: 1,
+	protocol.TouchMove: 2,
+}
+
+// SendTouch sends touch on a screen of size as a protocol.Touch, or as a
+// protocol.MultiTouch once the firmware is known to support it, see
+// MinVersions.
+func (l *Link) SendTouch(touch ScreenTouch, size ScreenSize) error {
+	x := touch.X / float32(size.Width)
+	y := touch.Y / float32(size.Height)
+	action := protocol.TouchAction(touch.Action)
+
+	if caps, _ := l.Capabilities(); caps.MultiTouch {
+		if action, ok := multiTouchActions[action]; ok {
+			return l.Send(&protocol.MultiTouch{Touches: []protocol.TouchPoint{{X: x, Y: y, Action: action}}})
+		}
+	}
+	return l.Send(&protocol.Touch{X: uint32(x * 10000), Y: uint32(y * 10000), Action: action})
+}
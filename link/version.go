@@ -0,0 +1,105 @@
+package link
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a firmware version of the dongle. Firmware versions are dates
+// followed by a build number, such as 2021.03.06.1355.
+type Version struct {
+	Year, Month, Day, Build int
+}
+
+// ParseVersion parses the version reported in protocol.SoftwareVersion,
+// ignoring any text around the numbers.
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimRight(s, "\x00")
+	start := strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' })
+	if start < 0 {
+		return Version{}, fmt.Errorf("%w: %q", ErrInvalidVersion, s)
+	}
+
+	var parts [4]int
+	for i, field := range strings.SplitN(s[start:], ".", len(parts)) {
+		end := strings.IndexFunc(field, func(r rune) bool { return r < '0' || r > '9' })
+		if end >= 0 {
+			field = field[:end]
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			break
+		}
+		parts[i] = n
+		if end >= 0 {
+			break
+		}
+	}
+	return Version{parts[0], parts[1], parts[2], parts[3]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%04d.%02d.%02d.%04d", v.Year, v.Month, v.Day, v.Build)
+}
+
+// Compare returns -1, 0 or +1 as v is older than, the same as or newer than w.
+func (v Version) Compare(w Version) int {
+	for _, d := range [][2]int{{v.Year, w.Year}, {v.Month, w.Month}, {v.Day, w.Day}, {v.Build, w.Build}} {
+		switch {
+		case d[0] < d[1]:
+			return -1
+		case d[0] > d[1]:
+			return +1
+		}
+	}
+	return 0
+}
+
+// AtLeast reports whether v is w or newer.
+func (v Version) AtLeast(w Version) bool {
+	return v.Compare(w) >= 0
+}
+
+// Capabilities are the features the dongle supports, which decide the
+// messages the link sends.
+type Capabilities struct {
+	MultiTouch      bool `json:"multiTouch"`
+	BoxSettings     bool `json:"boxSettings"`
+	WirelessCarPlay bool `json:"wirelessCarPlay"`
+	AndroidAuto     bool `json:"androidAuto"`
+	NaviVideo       bool `json:"naviVideo"`
+}
+
+// MinVersions are the earliest firmware versions each capability is assumed
+// from. They are guesses from the years the features appeared in the dongles
+// sold, not from release notes, which the vendor does not publish; raise them
+// when a firmware turns out to lack a feature. A zero version disables the
+// capability: MultiTouch changes how every touch is sent, so it stays off
+// until a firmware is verified to accept it. Wireless CarPlay depends on the
+// hardware instead, which the dongle reports with protocol.SupportWifi.
+var MinVersions = struct {
+	MultiTouch  Version
+	BoxSettings Version
+	AndroidAuto Version
+	NaviVideo   Version
+}{
+	BoxSettings: Version{Year: 2021},
+	AndroidAuto: Version{Year: 2021},
+	NaviVideo:   Version{Year: 2023},
+}
+
+// CapabilitiesOf returns the capabilities of the firmware version v.
+func CapabilitiesOf(v Version) Capabilities {
+	return Capabilities{
+		MultiTouch:  v.supports(MinVersions.MultiTouch),
+		BoxSettings: v.supports(MinVersions.BoxSettings),
+		AndroidAuto: v.supports(MinVersions.AndroidAuto),
+		NaviVideo:   v.supports(MinVersions.NaviVideo),
+	}
+}
+
+// supports reports whether v is from or newer, from being set.
+func (v Version) supports(from Version) bool {
+	return from != Version{} && v.AtLeast(from)
+}
@@ -0,0 +1,50 @@
+package link
+
+import (
+	"fmt"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// WifiBand is a band of the Wi-Fi access point of the dongle.
+type WifiBand string
+
+const (
+	WifiBand24GHz WifiBand = "2.4GHz"
+	WifiBand5GHz  WifiBand = "5GHz"
+)
+
+// command returns the command selecting b, or Invalid to leave the band
+// to the firmware when b is empty.
+func (b WifiBand) command() (protocol.CarPlayType, error) {
+	switch b {
+	case "":
+		return protocol.Invalid, nil
+	case WifiBand24GHz:
+		return protocol.Wifi24G, nil
+	case WifiBand5GHz:
+		return protocol.Wifi5G, nil
+	}
+	return protocol.Invalid, fmt.Errorf("%w: %q", ErrInvalidWifiBand, string(b))
+}
+
+// enableWifi enables wireless CarPlay on the band of the dongle config. The
+// dongle answers with protocol.SupportWifi when it supports it.
+func (l *Link) enableWifi() error {
+	if err := l.Send(&protocol.CarPlay{Command: protocol.SupportWifi}); err != nil {
+		return err
+	}
+	band, err := l.dongle.WifiBand.command()
+	if err != nil || band == protocol.Invalid {
+		return err
+	}
+	return l.Send(&protocol.CarPlay{Command: band})
+}
+
+// connectWifi asks the dongle to connect to the last phone wirelessly.
+func (l *Link) connectWifi() {
+	l.Debug("wireless carplay supported, connecting")
+	if err := l.Send(&protocol.CarPlay{Command: protocol.WifiConnect}); err != nil {
+		l.Error("wifi connect", "error", err.Error())
+	}
+}
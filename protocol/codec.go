@@ -0,0 +1,160 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+)
+
+//go:generate go run ./internal/codecgen -o codec_gen.go structures.go message.go
+
+// appendFixed appends s to b as n bytes, padded with zeros or cut.
+func appendFixed(b []byte, s string, n int) []byte {
+	if len(s) > n {
+		s = s[:n]
+	}
+	b = append(b, s...)
+	for i := len(s); i < n; i++ {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// The fields tagged struc:"skip" are the variable length end of a payload,
+// encoded by the appendTail and unmarshalTail methods below.
+
+func (m *Plugged) appendTail(b []byte) ([]byte, error) {
+	if m.Wifi {
+		b = binary.LittleEndian.AppendUint32(b, 1)
+	}
+	return b, nil
+}
+
+func (m *Plugged) unmarshalTail(data []byte) error {
+	if len(data) >= 4 {
+		m.Wifi = binary.LittleEndian.Uint32(data) != 0
+	}
+	return nil
+}
+
+// The end of AudioData is either a command, a volume duration or samples.
+func (m *AudioData) appendTail(b []byte) ([]byte, error) {
+	switch {
+	case len(m.Data) > 0:
+		b = append(b, m.Data...)
+	case m.Command != 0:
+		b = append(b, byte(m.Command))
+	case m.VolumeDuration != 0:
+		b = binary.LittleEndian.AppendUint32(b, uint32(m.VolumeDuration))
+	}
+	return b, nil
+}
+
+func (m *AudioData) unmarshalTail(data []byte) error {
+	switch len(data) {
+	case 1:
+		m.Command = AudioCommand(data[0])
+	case 4:
+		m.VolumeDuration = int32(binary.LittleEndian.Uint32(data))
+	default:
+		m.Data = data
+	}
+	return nil
+}
+
+func (m *MultiTouch) appendTail(b []byte) ([]byte, error) {
+	var err error
+	for i := range m.Touches {
+		if b, err = m.Touches[i].AppendBinary(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (m *MultiTouch) unmarshalTail(data []byte) error {
+	for ; len(data) >= 16; data = data[16:] {
+		var touch TouchPoint
+		if err := touch.UnmarshalBinary(data[:16]); err != nil {
+			return err
+		}
+		m.Touches = append(m.Touches, touch)
+	}
+	return nil
+}
+
+func (m *BluetoothDeviceName) appendTail(b []byte) ([]byte, error) {
+	return append(b, m.Data...), nil
+}
+
+func (m *BluetoothDeviceName) unmarshalTail(data []byte) error {
+	m.Data = NullTermString(data)
+	return nil
+}
+
+func (m *WifiDeviceName) appendTail(b []byte) ([]byte, error) {
+	return append(b, m.Data...), nil
+}
+
+func (m *WifiDeviceName) unmarshalTail(data []byte) error {
+	m.Data = NullTermString(data)
+	return nil
+}
+
+func (m *BluetoothPairedList) appendTail(b []byte) ([]byte, error) {
+	return append(b, m.Data...), nil
+}
+
+func (m *BluetoothPairedList) unmarshalTail(data []byte) error {
+	m.Data = NullTermString(data)
+	return nil
+}
+
+func (m *HiCarLink) appendTail(b []byte) ([]byte, error) {
+	return append(b, m.Link...), nil
+}
+
+func (m *HiCarLink) unmarshalTail(data []byte) error {
+	m.Link = NullTermString(data)
+	return nil
+}
+
+func (m *BoxSettings) appendTail(b []byte) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, data...), nil
+}
+
+func (m *BoxSettings) unmarshalTail(data []byte) error {
+	m.Raw = data
+	return json.Unmarshal(bytes.TrimRight(data, "\x00"), m)
+}
+
+func (m *PeerBluetoothAddress) appendTail(b []byte) ([]byte, error) {
+	return append(b, m.Address...), nil
+}
+
+func (m *PeerBluetoothAddress) unmarshalTail(data []byte) error {
+	m.Address = NullTermString(data)
+	return nil
+}
+
+func (m *MediaData) appendTail(b []byte) ([]byte, error) {
+	return append(b, m.Data...), nil
+}
+
+func (m *MediaData) unmarshalTail(data []byte) error {
+	m.Data = data
+	return nil
+}
+
+func (m *Unknown) appendTail(b []byte) ([]byte, error) {
+	return append(b, m.Data...), nil
+}
+
+func (m *Unknown) unmarshalTail(data []byte) error {
+	m.Data = data
+	return nil
+}
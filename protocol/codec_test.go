@@ -0,0 +1,260 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/lunixbochs/struc"
+)
+
+// The reflect codec below, built on the struc tags of the messages, is the
+// codec the generated one replaced. It is kept as the oracle of the fields
+// struc describes. The variable length ends of the payloads, which struc
+// skips, are left out of it: they are checked against the frames of
+// testdata/layout instead, which do not share the assumptions of the
+// generator.
+
+func reflectPackPayload(buffer io.Writer, payload interface{}) error {
+	if reflect.ValueOf(payload).Elem().NumField() == 0 {
+		return nil
+	}
+	return struc.Pack(buffer, payload)
+}
+
+// registeredID looks up the ID payload is registered under by its type
+// rather than by its Type method.
+func registeredID(payload interface{}) (uint32, bool) {
+	for id, factory := range DefaultRegistry.factories {
+		if reflect.TypeOf(factory()) == reflect.TypeOf(payload) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func reflectPackHeader(payload interface{}, buffer io.Writer, data []byte) error {
+	msgType, found := registeredID(payload)
+	if unknown, ok := payload.(*Unknown); ok {
+		msgType, found = unknown.ID, true
+	}
+	if !found {
+		return errors.New("No message found")
+	}
+	msgTypeN := (msgType ^ 0xffffffff) & 0xffffffff
+	msg := &Header{Magic: magicNumber, Length: uint32(len(data)), Type: msgType, TypeN: msgTypeN}
+	err := struc.Pack(buffer, msg)
+	if err != nil {
+		return err
+	}
+	_, err = buffer.Write(data)
+	return err
+}
+
+func reflectMarshal(payload interface{}) ([]byte, error) {
+	var buf, buffer bytes.Buffer
+	err := reflectPackPayload(&buf, payload)
+	if err != nil {
+		return nil, err
+	}
+	err = reflectPackHeader(payload, &buffer, buf.Bytes())
+	return buffer.Bytes(), err
+}
+
+// reflectUnmarshal decodes the fields struc describes, leaving the ones it
+// skips to their zero value.
+func reflectUnmarshal(data []byte, payload interface{}) error {
+	if len(data) > 0 && reflect.ValueOf(payload).Elem().NumField() > 0 {
+		err := struc.Unpack(bytes.NewBuffer(data), payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	if payload, ok := payload.(*Header); ok {
+		if payload.Magic != magicNumber {
+			return errors.New("Invalid magic number")
+		}
+		if (payload.Type^0xffffffff)&0xffffffff != payload.TypeN {
+			return errors.New("Invalid type")
+		}
+	}
+	return nil
+}
+
+// structFields returns the encoding by struc of the fields of payload it
+// describes, to compare payloads on those fields only.
+func structFields(t *testing.T, payload interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := reflectPackPayload(&buf, payload); err != nil {
+		t.Fatalf("pack %T: %v", payload, err)
+	}
+	return buf.Bytes()
+}
+
+// samples are messages of every type with their fields set.
+var samples = []Message{
+	&SendFile{FileName: "/tmp/screen_dpi\x00", Content: []byte{160, 0, 0, 0}},
+	&Open{Width: 1280, Height: 720, VideoFrameRate: 30, Format: 5, PacketMax: 4915200, IBoxVersion: 2, PhoneWorkMode: 2},
+	&Heartbeat{},
+	&ManufacturerInfo{A: 1, B: -2},
+	&CarPlay{Command: BtnSiri},
+	&SoftwareVersion{Version: "2021.03.06.0001\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"},
+	&BluetoothAddress{Address: "00:11:22:33:44:55"},
+	&BluetoothPIN{Address: "0000"},
+	&Plugged{PhoneType: PhoneTypeCarPlay},
+	&Plugged{PhoneType: PhoneTypeCarPlay, Wifi: true},
+	&Phase{Phase: 7},
+	&Unplugged{},
+	&VideoData{Width: 1280, Height: 720, Flags: 1, Length: 5, Data: []byte{0, 0, 0, 1, 0x65}},
+	&NaviVideoData{Width: 800, Height: 480, Length: 3, Data: []byte{0, 0, 1}},
+	&AudioData{DecodeType: 5, Volume: 0.5, AudioType: 3, Data: []byte{1, 2, 3, 4, 5, 6}},
+	&AudioData{DecodeType: 2, AudioType: 1, Command: AudioSiriStart},
+	&AudioData{DecodeType: 2, Volume: 0.25, AudioType: 1, VolumeDuration: 500},
+	&Touch{Action: TouchDown, X: 5000, Y: 2500},
+	&MultiTouch{Touches: []TouchPoint{{X: 0.5, Y: 0.25, Action: 1}, {X: 0.75, Y: 0.5, Action: 2, ID: 1}}},
+	&BluetoothDeviceName{Data: "MyCar"},
+	&WifiDeviceName{Data: "MyCar"},
+	&BluetoothPairedList{Data: "00:11:22:33:44:55iPhone\n"},
+	&LogoType{Logo: 2},
+	&DisconnectPhone{},
+	&CloseDongle{},
+	&HiCarLink{Link: "hicar://link"},
+	&BoxSettings{MediaDelay: 300, BoxName: "MyCar", NaviScreen: &NaviScreenInfo{Width: 800, Height: 480, FPS: 15}},
+	&PeerBluetoothAddress{Address: "00:11:22:33:44:55"},
+	&MediaData{MediaType: MediaTypeData, Data: []byte(`{"MediaSongName":"Song"}`)},
+	&UpdateProgress{Progress: 50},
+	&UpdateState{State: 1},
+	&Unknown{ID: 0x99999, Data: []byte{1, 2, 3}},
+}
+
+// TestMarshalMatchesReflect checks that the frames of the generated codec
+// start with the header and the fields struc encodes.
+func TestMarshalMatchesReflect(t *testing.T) {
+	for _, msg := range samples {
+		want, err := reflectMarshal(msg)
+		if err != nil {
+			t.Fatalf("reflect marshal %#v: %v", msg, err)
+		}
+		got, err := Marshal(msg)
+		if err != nil {
+			t.Fatalf("marshal %#v: %v", msg, err)
+		}
+		// The lengths differ by the end struc skips.
+		if len(got) < len(want) || !bytes.Equal(got[:4], want[:4]) || !bytes.Equal(got[8:len(want)], want[8:]) {
+			t.Errorf("marshal %#v\n got %x\nwant %x...", msg, got, want)
+		}
+	}
+}
+
+// TestUnmarshalMatchesReflect checks that the generated codec decodes the
+// fields struc describes as struc does, and fails where struc fails.
+func TestUnmarshalMatchesReflect(t *testing.T) {
+	for _, msg := range samples {
+		data, err := Marshal(msg)
+		if err != nil {
+			t.Fatalf("marshal %#v: %v", msg, err)
+		}
+		payload := data[headerSize:]
+		for n := len(payload); n > 0; n-- {
+			want := reflect.New(reflect.TypeOf(msg).Elem()).Interface()
+			wantErr := reflectUnmarshal(payload[:n], want)
+			got := reflect.New(reflect.TypeOf(msg).Elem()).Interface().(Message)
+			gotErr := Unmarshal(payload[:n], got)
+			switch {
+			case n == len(payload) && gotErr != nil:
+				t.Errorf("unmarshal %T: %v", msg, gotErr)
+			case wantErr != nil && gotErr == nil:
+				t.Errorf("unmarshal %T of %d bytes: got no error, want %v", msg, n, wantErr)
+			case wantErr == nil && gotErr == nil && !bytes.Equal(structFields(t, got), structFields(t, want)):
+				t.Errorf("unmarshal %T of %d bytes\n got %#v\nwant %#v", msg, n, got, want)
+			}
+		}
+	}
+}
+
+func TestUnmarshalHeaderMatchesReflect(t *testing.T) {
+	for _, msg := range samples {
+		data, err := reflectMarshal(msg)
+		if err != nil {
+			t.Fatalf("reflect marshal %#v: %v", msg, err)
+		}
+		var got, want Header
+		if err := reflectUnmarshal(data[:headerSize], &want); err != nil {
+			t.Fatalf("reflect unmarshal header of %T: %v", msg, err)
+		}
+		if err := Unmarshal(data[:headerSize], &got); err != nil {
+			t.Fatalf("unmarshal header of %T: %v", msg, err)
+		}
+		if got != want {
+			t.Errorf("unmarshal header of %T: got %#v, want %#v", msg, got, want)
+		}
+	}
+
+	bad := []byte{0, 0, 0, 0, 4, 0, 0, 0, 8, 0, 0, 0, 0xf7, 0xff, 0xff, 0xff}
+	var hdr Header
+	if reflectUnmarshal(bad, &hdr) == nil || Unmarshal(bad, &hdr) == nil {
+		t.Errorf("header with a bad magic number decoded")
+	}
+}
+
+func videoFrame(b *testing.B) []byte {
+	data := bytes.Repeat([]byte{0xab}, 64*1024)
+	frame, err := Marshal(&VideoData{Width: 1280, Height: 720, Data: data})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return frame
+}
+
+// BenchmarkUnmarshalVideo compares the generated codec with the reflect one
+// it replaced on a 64KiB video frame.
+func BenchmarkUnmarshalVideo(b *testing.B) {
+	payload := videoFrame(b)[headerSize:]
+	codecs := []struct {
+		name      string
+		unmarshal func([]byte, Message) error
+	}{
+		{"generated", func(data []byte, payload Message) error { return Unmarshal(data, payload) }},
+		{"reflect", func(data []byte, payload Message) error { return reflectUnmarshal(data, payload) }},
+	}
+	for _, c := range codecs {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				var data VideoData
+				if err := c.unmarshal(payload, &data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMarshalVideo compares the generated codec with the reflect one it
+// replaced on a 64KiB video frame.
+func BenchmarkMarshalVideo(b *testing.B) {
+	data := &VideoData{Width: 1280, Height: 720, Data: bytes.Repeat([]byte{0xab}, 64*1024)}
+	codecs := []struct {
+		name    string
+		marshal func(Message) ([]byte, error)
+	}{
+		{"generated", Marshal},
+		{"reflect", func(payload Message) ([]byte, error) { return reflectMarshal(payload) }},
+	}
+	for _, c := range codecs {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data.Data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := c.marshal(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// FuzzUnmarshal decodes arbitrary payloads of arbitrary types. Decoding must
+// not panic, and a decoded message is encoded into a payload that decodes
+// and encodes to the same bytes.
+func FuzzUnmarshal(f *testing.F) {
+	for _, msg := range samples {
+		data, err := Marshal(msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(msg.Type(), data[headerSize:])
+	}
+	f.Add(uint32(0x07), []byte{})
+	f.Add(uint32(0x19), []byte("null"))
+
+	f.Fuzz(func(t *testing.T, typ uint32, data []byte) {
+		payload := GetPayloadByHeader(Header{Type: typ})
+		if payload.Type() != typ {
+			t.Fatalf("payload of type %#x has type %#x", typ, payload.Type())
+		}
+		if Unmarshal(data, payload) != nil {
+			return
+		}
+		encoded, err := payload.AppendBinary(nil)
+		if err != nil {
+			t.Fatalf("encode %#v: %v", payload, err)
+		}
+
+		again := GetPayloadByHeader(Header{Type: typ})
+		if err := Unmarshal(encoded, again); err != nil {
+			t.Fatalf("decode %x encoded from %#v: %v", encoded, payload, err)
+		}
+		reencoded, err := again.AppendBinary(nil)
+		if err != nil {
+			t.Fatalf("encode %#v: %v", again, err)
+		}
+		if !bytes.Equal(reencoded, encoded) {
+			t.Fatalf("encoding of %#x is not stable\n got %x\nwant %x", typ, reencoded, encoded)
+		}
+	})
+}
+
+// FuzzUnmarshalHeader decodes arbitrary headers, which must announce no
+// more than MaxLength bytes once valid.
+func FuzzUnmarshalHeader(f *testing.F) {
+	for _, msg := range samples {
+		data, err := Marshal(msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data[:headerSize])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var hdr Header
+		if Unmarshal(data, &hdr) != nil {
+			return
+		}
+		if hdr.Length > MaxLength {
+			t.Fatalf("header of %d bytes accepted", hdr.Length)
+		}
+		if hdr.Type^hdr.TypeN != 0xffffffff {
+			t.Fatalf("header of type %#x with check %#x accepted", hdr.Type, hdr.TypeN)
+		}
+	})
+}
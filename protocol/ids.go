@@ -0,0 +1,35 @@
+package protocol
+
+// The Type of every message is the ID in its Header.
+
+func (*Open) Type() uint32                 { return 0x01 }
+func (*Plugged) Type() uint32              { return 0x02 }
+func (*Phase) Type() uint32                { return 0x03 }
+func (*Unplugged) Type() uint32            { return 0x04 }
+func (*Touch) Type() uint32                { return 0x05 }
+func (*VideoData) Type() uint32            { return 0x06 }
+func (*AudioData) Type() uint32            { return 0x07 }
+func (*CarPlay) Type() uint32              { return 0x08 }
+func (*LogoType) Type() uint32             { return 0x09 }
+func (*BluetoothAddress) Type() uint32     { return 0x0a }
+func (*BluetoothPIN) Type() uint32         { return 0x0c }
+func (*BluetoothDeviceName) Type() uint32  { return 0x0d }
+func (*WifiDeviceName) Type() uint32       { return 0x0e }
+func (*DisconnectPhone) Type() uint32      { return 0x0f }
+func (*BluetoothPairedList) Type() uint32  { return 0x12 }
+func (*ManufacturerInfo) Type() uint32     { return 0x14 }
+func (*CloseDongle) Type() uint32          { return 0x15 }
+func (*MultiTouch) Type() uint32           { return 0x17 }
+func (*HiCarLink) Type() uint32            { return 0x18 }
+func (*BoxSettings) Type() uint32          { return 0x19 }
+func (*PeerBluetoothAddress) Type() uint32 { return 0x23 }
+func (*MediaData) Type() uint32            { return 0x2a }
+func (*NaviVideoData) Type() uint32        { return 0x2c }
+func (*SendFile) Type() uint32             { return 0x99 }
+func (*Heartbeat) Type() uint32            { return 0xaa }
+func (*UpdateProgress) Type() uint32       { return 0xb1 }
+func (*UpdateState) Type() uint32          { return 0xbb }
+func (*SoftwareVersion) Type() uint32      { return 0xcc }
+
+// Type is the ID the message was received with.
+func (m *Unknown) Type() uint32 { return m.ID }
@@ -0,0 +1,375 @@
+// Command codecgen generates the MarshalBinary, UnmarshalBinary and
+// AppendBinary methods of the messages of package protocol from the struc
+// tags of their fields, so that frames are encoded without reflection.
+//
+// Fields tagged struc:"skip" are the variable length end of a message, which
+// is encoded by its hand written appendTail and unmarshalTail methods.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// field is a field of a message and how it is encoded.
+type field struct {
+	name string
+	// typ is the Go type of the field, such as int32 or NullTermString.
+	typ string
+	// kind is how the field is encoded: "uint32", "float32", "fixed" for
+	// [size]byte, "bytes" for a []byte or a string sized by another field,
+	// or "skip".
+	kind string
+	size int
+	// sizeOf is the field this one holds the length of.
+	sizeOf string
+}
+
+// message is a struct type, or a type defined as another message (alias).
+type message struct {
+	name   string
+	fields []field
+	alias  string
+}
+
+func (m *message) hasTail() bool {
+	for _, f := range m.fields {
+		if f.kind == "skip" {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedSize is the size of the fields of a fixed size.
+func (m *message) fixedSize() int {
+	n := 0
+	for _, f := range m.fields {
+		n += f.size
+	}
+	return n
+}
+
+func (m *message) packed() bool {
+	for _, f := range m.fields {
+		if f.kind != "skip" {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	out := flag.String("o", "codec_gen.go", "output file")
+	flag.Parse()
+
+	var messages []*message
+	byName := map[string]*message{}
+	fset := token.NewFileSet()
+	for _, path := range flag.Args() {
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.TypeSpec)
+				m, err := parseType(spec)
+				if err != nil {
+					log.Fatalf("%s: %v", spec.Name.Name, err)
+				}
+				if m != nil {
+					messages = append(messages, m)
+					byName[m.name] = m
+				}
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	for _, m := range messages {
+		if m.alias != "" {
+			if byName[m.alias] == nil {
+				continue
+			}
+			writeAlias(&body, m)
+			continue
+		}
+		writeMessage(&body, m)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by codecgen from %s; DO NOT EDIT.\n\npackage protocol\n\nimport (\n", strings.Join(flag.Args(), ", "))
+	for _, pkg := range []string{"encoding/binary", "io", "math"} {
+		if bytes.Contains(body.Bytes(), []byte(pkg[strings.LastIndex(pkg, "/")+1:]+".")) {
+			fmt.Fprintf(&buf, "%q\n", pkg)
+		}
+	}
+	buf.WriteString(")\n")
+	buf.Write(body.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("format: %v\n%s", err, buf.Bytes())
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseType returns the message of spec, or nil for a type that is not
+// encoded with struc: one with fields but no struc tags.
+func parseType(spec *ast.TypeSpec) (*message, error) {
+	switch typ := spec.Type.(type) {
+	case *ast.Ident:
+		return &message{name: spec.Name.Name, alias: typ.Name}, nil
+	case *ast.StructType:
+		m := &message{name: spec.Name.Name}
+		tagged := false
+		for _, f := range typ.Fields.List {
+			var tag string
+			if f.Tag != nil {
+				unquoted, err := strconv.Unquote(f.Tag.Value)
+				if err != nil {
+					return nil, err
+				}
+				var ok bool
+				tag, ok = reflect.StructTag(unquoted).Lookup("struc")
+				tagged = tagged || ok
+			}
+			for _, name := range f.Names {
+				// Unexported fields are state of the message, not part of it.
+				if !name.IsExported() {
+					continue
+				}
+				fd, err := parseField(name.Name, typeString(f.Type), tag)
+				if err != nil {
+					return nil, err
+				}
+				m.fields = append(m.fields, fd)
+			}
+		}
+		if !tagged && len(m.fields) > 0 {
+			return nil, nil
+		}
+		// Fields without a type in their tag are sized by another field.
+		for _, f := range m.fields {
+			if f.sizeOf == "" {
+				continue
+			}
+			found := false
+			for i := range m.fields {
+				if m.fields[i].name == f.sizeOf {
+					m.fields[i].kind = "bytes"
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s: sizeof unknown field %s", f.name, f.sizeOf)
+			}
+		}
+		for _, f := range m.fields {
+			if f.kind == "" {
+				return nil, fmt.Errorf("%s: unsupported field of type %s", f.name, f.typ)
+			}
+		}
+		return m, nil
+	}
+	return nil, nil
+}
+
+func parseField(name, typ, tag string) (field, error) {
+	f := field{name: name, typ: typ}
+	for _, opt := range strings.Split(tag, ",") {
+		switch {
+		case opt == "" || opt == "little":
+		case opt == "skip":
+			f.kind = "skip"
+		case strings.HasPrefix(opt, "sizeof="):
+			f.sizeOf = strings.TrimPrefix(opt, "sizeof=")
+		case opt == "int32" || opt == "uint32":
+			f.kind, f.size = "uint32", 4
+		case opt == "float32":
+			f.kind, f.size = "float32", 4
+		case opt == "[]byte":
+		case strings.HasPrefix(opt, "[") && strings.HasSuffix(opt, "]byte"):
+			size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(opt, "["), "]byte"))
+			if err != nil {
+				return f, fmt.Errorf("%s: %v", name, err)
+			}
+			f.kind, f.size = "fixed", size
+		default:
+			return f, fmt.Errorf("%s: unsupported struc option %q", name, opt)
+		}
+	}
+	if tag == "" {
+		switch typ {
+		case "int32", "uint32":
+			f.kind, f.size = "uint32", 4
+		case "float32":
+			f.kind, f.size = "float32", 4
+		}
+	}
+	return f, nil
+}
+
+func typeString(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name
+	case *ast.ArrayType:
+		if expr.Len == nil {
+			return "[]" + typeString(expr.Elt)
+		}
+	case *ast.StarExpr:
+		return "*" + typeString(expr.X)
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+func writeAlias(buf *bytes.Buffer, m *message) {
+	fmt.Fprintf(buf, `
+// AppendBinary appends the payload of m to b.
+func (m *%[1]s) AppendBinary(b []byte) ([]byte, error) {
+	return (*%[2]s)(m).AppendBinary(b)
+}
+
+// MarshalBinary returns the payload of m.
+func (m *%[1]s) MarshalBinary() ([]byte, error) {
+	return (*%[2]s)(m).MarshalBinary()
+}
+
+// UnmarshalBinary decodes the payload data into m.
+func (m *%[1]s) UnmarshalBinary(data []byte) error {
+	return (*%[2]s)(m).UnmarshalBinary(data)
+}
+`, m.name, m.alias)
+}
+
+func writeMessage(buf *bytes.Buffer, m *message) {
+	fmt.Fprintf(buf, "\n// AppendBinary appends the payload of m to b.\nfunc (m *%s) AppendBinary(b []byte) ([]byte, error) {\n", m.name)
+	for _, f := range m.fields {
+		switch f.kind {
+		case "uint32":
+			value := convert("uint32", "m."+f.name, f.typ)
+			if f.sizeOf != "" {
+				value = "uint32(len(m." + f.sizeOf + "))"
+			}
+			fmt.Fprintf(buf, "b = binary.LittleEndian.AppendUint32(b, %s)\n", value)
+		case "float32":
+			fmt.Fprintf(buf, "b = binary.LittleEndian.AppendUint32(b, math.Float32bits(m.%s))\n", f.name)
+		case "fixed":
+			fmt.Fprintf(buf, "b = appendFixed(b, %s, %d)\n", convert("string", "m."+f.name, f.typ), f.size)
+		case "bytes":
+			fmt.Fprintf(buf, "b = append(b, m.%s...)\n", f.name)
+		}
+	}
+	if m.hasTail() {
+		buf.WriteString("return m.appendTail(b)\n}\n")
+	} else {
+		buf.WriteString("return b, nil\n}\n")
+	}
+
+	fmt.Fprintf(buf, "\n// MarshalBinary returns the payload of m.\nfunc (m *%s) MarshalBinary() ([]byte, error) {\n", m.name)
+	if size := m.fixedSize(); size > 0 {
+		fmt.Fprintf(buf, "return m.AppendBinary(make([]byte, 0, %d))\n}\n", size)
+	} else {
+		buf.WriteString("return m.AppendBinary(nil)\n}\n")
+	}
+
+	fmt.Fprintf(buf, "\n// UnmarshalBinary decodes the payload data into m.\nfunc (m *%s) UnmarshalBinary(data []byte) error {\n", m.name)
+	if m.packed() {
+		buf.WriteString("// An empty payload leaves the fields zero.\nif len(data) == 0 {\nreturn nil\n}\n")
+	}
+	// Statements consuming data are left out at the end of the payload.
+	var stmts []string
+	consumed := 0
+	var run []field
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		size := 0
+		for _, f := range run {
+			size += f.size
+		}
+		stmts = append(stmts, fmt.Sprintf("if len(data) < %d {\nreturn io.ErrUnexpectedEOF\n}\n", size))
+		off := 0
+		for _, f := range run {
+			at := "data"
+			if off > 0 {
+				at = fmt.Sprintf("data[%d:]", off)
+			}
+			switch f.kind {
+			case "uint32":
+				stmts = append(stmts, fmt.Sprintf("m.%s = %s\n", f.name, convert(f.typ, "binary.LittleEndian.Uint32("+at+")", "uint32")))
+			case "float32":
+				stmts = append(stmts, fmt.Sprintf("m.%s = math.Float32frombits(binary.LittleEndian.Uint32(%s))\n", f.name, at))
+			case "fixed":
+				stmts = append(stmts, fmt.Sprintf("m.%s = %s\n", f.name, convert(f.typ, fmt.Sprintf("data[%d:%d]", off, off+f.size), "[]byte")))
+			}
+			off += f.size
+		}
+		stmts = append(stmts, fmt.Sprintf("data = data[%d:]\n", size))
+		consumed = len(stmts)
+		run = nil
+	}
+	for _, f := range m.fields {
+		switch f.kind {
+		case "uint32", "float32", "fixed":
+			run = append(run, f)
+		case "bytes":
+			flush()
+			size := sizeField(m, f.name)
+			stmts = append(stmts,
+				fmt.Sprintf("if m.%[1]s < 0 || len(data) < int(m.%[1]s) {\nreturn io.ErrUnexpectedEOF\n}\n", size),
+				fmt.Sprintf("m.%s = %s\n", f.name, convert(f.typ, "data[:m."+size+"]", "[]byte")),
+				fmt.Sprintf("data = data[m.%s:]\n", size))
+			consumed = len(stmts)
+		}
+	}
+	flush()
+	if !m.hasTail() && consumed > 0 {
+		stmts = stmts[:consumed-1]
+	}
+	for _, stmt := range stmts {
+		buf.WriteString(stmt)
+	}
+	if m.hasTail() {
+		buf.WriteString("return m.unmarshalTail(data)\n}\n")
+	} else {
+		buf.WriteString("return nil\n}\n")
+	}
+}
+
+// convert converts expr of type from to type to, unless they are the same.
+func convert(to, expr, from string) string {
+	if to == from {
+		return expr
+	}
+	return to + "(" + expr + ")"
+}
+
+// sizeField is the field holding the length of the field name.
+func sizeField(m *message, name string) string {
+	for _, f := range m.fields {
+		if f.sizeOf == name {
+			return f.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// layoutMessages are the messages of the frames in testdata/layout, one file
+// per message. The frames are written by hand after the layouts of pycarplay
+// and node-carplay rather than captured from a dongle, so they check the codec
+// against those layouts only.
+var layoutMessages = map[string]Message{
+	"open":              &Open{Width: 1280, Height: 720, VideoFrameRate: 30, Format: 5, PacketMax: 4915200, IBoxVersion: 2, PhoneWorkMode: 2},
+	"send_file":         &SendFile{FileName: "/tmp/screen_dpi\x00", FileNameSize: 16, Content: []byte{160, 0, 0, 0}, ContentSize: 4},
+	"heartbeat":         &Heartbeat{},
+	"software_version":  &SoftwareVersion{Version: NullTermString("2021.03.06.1355" + string(make([]byte, 17)))},
+	"bluetooth_address": &BluetoothAddress{Address: "00:11:22:33:44:55"},
+	"wifi_device_name":  &WifiDeviceName{Data: "AutoBox-1234\x00"},
+	"plugged_wifi":      &Plugged{PhoneType: PhoneTypeCarPlay, Wifi: true},
+	"phase":             &Phase{Phase: 7},
+	"carplay_siri":      &CarPlay{Command: BtnSiri},
+	"touch_down":        &Touch{Action: TouchDown, X: 5000, Y: 2500},
+	"audio_media_start": &AudioData{DecodeType: 2, AudioType: 1, Command: AudioMediaStart},
+	"audio_volume":      &AudioData{DecodeType: 2, Volume: 0.2, AudioType: 1, VolumeDuration: 500},
+	"audio_samples":     &AudioData{DecodeType: 2, Volume: 1, AudioType: 1, Data: []byte{0x10, 0x00, 0xf0, 0xff, 0x20, 0x00, 0xe0, 0xff}},
+	"video_aud":         &VideoData{Width: 1280, Height: 720, Length: 6, Data: []byte{0, 0, 0, 1, 0x09, 0xf0}},
+	"media_info":        &MediaData{MediaType: MediaTypeData, Data: []byte(`{"MediaSongName":"Song","MediaArtistName":"Artist"}` + "\x00")},
+	"box_settings":      &BoxSettings{MediaDelay: 300, BoxName: "MyCar"},
+}
+
+// readLayout reads a frame of testdata/layout. Each line holds hex bytes or a
+// quoted Go string, and a # starts a comment.
+func readLayout(t *testing.T, name string) []byte {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "layout", name+".hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var frame []byte
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, `"`) {
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				t.Fatalf("%s.hex:%d: %v", name, n, err)
+			}
+			frame = append(frame, s...)
+			continue
+		}
+		line, _, _ = strings.Cut(line, "#")
+		b, err := hex.DecodeString(strings.Join(strings.Fields(line), ""))
+		if err != nil {
+			t.Fatalf("%s.hex:%d: %v", name, n, err)
+		}
+		frame = append(frame, b...)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestLayout(t *testing.T) {
+	for name, msg := range layoutMessages {
+		t.Run(name, func(t *testing.T) {
+			want := readLayout(t, name)
+
+			var hdr Header
+			if err := Unmarshal(want[:headerSize], &hdr); err != nil {
+				t.Fatal(err)
+			}
+			if int(hdr.Length) != len(want)-headerSize {
+				t.Fatalf("header length %d, payload of %d bytes", hdr.Length, len(want)-headerSize)
+			}
+			payload := GetPayloadByHeader(hdr)
+			if err := Unmarshal(want[headerSize:], payload); err != nil {
+				t.Fatal(err)
+			}
+			if settings, ok := payload.(*BoxSettings); ok {
+				settings.Raw = nil
+			}
+			if !reflect.DeepEqual(payload, msg) {
+				t.Errorf("unmarshal\n got %#v\nwant %#v", payload, msg)
+			}
+
+			frame, err := Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(frame, want) {
+				t.Errorf("marshal\n got %x\nwant %x", frame, want)
+			}
+		})
+	}
+}
@@ -2,34 +2,17 @@ package protocol
 
 import (
 	"bytes"
-	"encoding/binary"
+	"encoding"
+	"encoding/json"
 	"errors"
-	"io"
-	"reflect"
-
-	"github.com/lunixbochs/struc"
 )
 
 const magicNumber uint32 = 0x55aa55aa
 
-var messageTypes = map[reflect.Type]uint32{
-	reflect.TypeOf(&SendFile{}):            0x99,
-	reflect.TypeOf(&Open{}):                0x01,
-	reflect.TypeOf(&Heartbeat{}):           0xaa,
-	reflect.TypeOf(&ManufacturerInfo{}):    0x14,
-	reflect.TypeOf(&CarPlay{}):             0x08,
-	reflect.TypeOf(&SoftwareVersion{}):     0xcc,
-	reflect.TypeOf(&BluetoothAddress{}):    0x0a,
-	reflect.TypeOf(&BluetoothPIN{}):        0x0c,
-	reflect.TypeOf(&Plugged{}):             0x02,
-	reflect.TypeOf(&Unplugged{}):           0x04,
-	reflect.TypeOf(&VideoData{}):           0x06,
-	reflect.TypeOf(&AudioData{}):           0x07,
-	reflect.TypeOf(&Touch{}):               0x05,
-	reflect.TypeOf(&BluetoothDeviceName{}): 0x0d,
-	reflect.TypeOf(&WifiDeviceName{}):      0x0e,
-	reflect.TypeOf(&BluetoothPairedList{}): 0x12,
-}
+// MaxLength is the largest payload a Header may announce, above the
+// PacketMax of 4915200 bytes the dongle is opened with, so that a corrupt
+// header does not make the reader allocate gigabytes.
+const MaxLength = 8 << 20
 
 // Header is header structure of data protocol
 type Header struct {
@@ -39,82 +22,103 @@ type Header struct {
 	TypeN  uint32 `struc:"uint32,little"`
 }
 
-func packPayload(buffer io.Writer, payload interface{}) error {
-	if reflect.ValueOf(payload).Elem().NumField() > 0 {
-		return struc.Pack(buffer, payload)
-	}
-	// Nothing to do
-	return nil
+// Message is a message of the protocol. Type is the ID in its Header, unless
+// the message is registered under another ID in DefaultRegistry, and the
+// encoding methods are generated in codec_gen.go from the struc tags of its
+// fields.
+type Message interface {
+	Type() uint32
+	AppendBinary(b []byte) ([]byte, error)
+	UnmarshalBinary(data []byte) error
 }
 
-func packHeader(payload interface{}, buffer io.Writer, data []byte) error {
-	msgType, found := messageTypes[reflect.TypeOf(payload)]
-	if !found {
-		return errors.New("No message found")
-	}
-	msgTypeN := (msgType ^ 0xffffffff) & 0xffffffff
-	msg := &Header{Magic: magicNumber, Length: uint32(len(data)), Type: msgType, TypeN: msgTypeN}
-	err := struc.Pack(buffer, msg)
-	if err != nil {
-		return err
-	}
-	_, err = buffer.Write(data)
-	return err
-}
+// headerSize is the size of an encoded Header.
+const headerSize = 16
 
-func Marshal(payload interface{}) ([]byte, error) {
-	var buf, buffer bytes.Buffer
-	err := packPayload(&buf, payload)
+func Marshal(payload Message) ([]byte, error) {
+	// The header is written once the length of the payload is known.
+	buf, err := payload.AppendBinary(make([]byte, headerSize, 64))
 	if err != nil {
 		return nil, err
 	}
-	err = packHeader(payload, &buffer, buf.Bytes())
-	return buffer.Bytes(), err
+	id, ok := DefaultRegistry.ID(payload)
+	if !ok {
+		id = payload.Type()
+	}
+	hdr := Header{Magic: magicNumber, Length: uint32(len(buf) - headerSize), Type: id, TypeN: id ^ 0xffffffff}
+	if _, err := hdr.AppendBinary(buf[:0]); err != nil {
+		return nil, err
+	}
+	return buf, nil
 }
 
-func GetPayloadByHeader(hdr Header) interface{} {
-	for key, value := range messageTypes {
-		if value == hdr.Type {
-			return reflect.New(key.Elem()).Interface()
-		}
+// GetPayloadByHeader returns a new message of the type of hdr, or an
+// *Unknown when it is not registered in DefaultRegistry.
+func GetPayloadByHeader(hdr Header) Message {
+	if msg, ok := DefaultRegistry.New(hdr.Type); ok {
+		return msg
 	}
-	return &Unknown{Type: hdr.Type}
+	return &Unknown{ID: hdr.Type}
 }
 
-func Unmarshal(data []byte, payload interface{}) error {
-	if len(data) > 0 {
-		err := struc.Unpack(bytes.NewBuffer(data), payload)
-		if err != nil {
-			return err
-		}
+// Unmarshal decodes data into payload, a Message or a *Header.
+func Unmarshal(data []byte, payload encoding.BinaryUnmarshaler) error {
+	if err := payload.UnmarshalBinary(data); err != nil {
+		return err
 	}
 
-	switch payload := payload.(type) {
-	case *Header:
-		if payload.Magic != magicNumber {
+	if hdr, ok := payload.(*Header); ok {
+		if hdr.Magic != magicNumber {
 			return errors.New("Invalid magic number")
 		}
-		if (payload.Type^0xffffffff)&0xffffffff != payload.TypeN {
+		if hdr.Type^0xffffffff != hdr.TypeN {
 			return errors.New("Invalid type")
 		}
-	case *AudioData:
-		switch len(data) - 12 {
-		case 1:
-			payload.Command = AudioCommand(data[12])
-		case 4:
-			binary.Read(bytes.NewBuffer(data[12:]), binary.LittleEndian, &payload.VolumeDuration)
-		default:
-			payload.Data = data[12:]
+		if hdr.Length > MaxLength {
+			return errors.New("Payload too large")
 		}
-	case *BluetoothDeviceName:
-		payload.Data = NullTermString(data)
-	case *WifiDeviceName:
-		payload.Data = NullTermString(data)
-	case *BluetoothPairedList:
-		payload.Data = NullTermString(data)
-	case *Unknown:
-		payload.Data = data
 	}
-
 	return nil
 }
+
+// Decode decodes the data of m into a *MediaInfo or an *AlbumArt as its type
+// tells. Data of other types is returned as is.
+func (m *MediaData) Decode() (interface{}, error) {
+	switch m.MediaType {
+	case MediaTypeData:
+		var info MediaInfo
+		if err := json.Unmarshal(bytes.TrimRight(m.Data, "\x00"), &info); err != nil {
+			return nil, err
+		}
+		return &info, nil
+	case MediaTypeAlbumArt:
+		return &AlbumArt{Data: m.Data}, nil
+	}
+	return m, nil
+}
+
+// Merge updates m with the fields set in update. Position is reset along
+// with the track.
+func (m *MediaInfo) Merge(update *MediaInfo) {
+	if update.Title != "" && update.Title != m.Title {
+		m.Position = 0
+	}
+	if update.Title != "" {
+		m.Title = update.Title
+	}
+	if update.Artist != "" {
+		m.Artist = update.Artist
+	}
+	if update.Album != "" {
+		m.Album = update.Album
+	}
+	if update.App != "" {
+		m.App = update.App
+	}
+	if update.Duration != 0 {
+		m.Duration = update.Duration
+	}
+	if update.Position != 0 {
+		m.Position = update.Position
+	}
+}
@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"sync"
+)
+
+// bufferPool holds the buffers of received video frames for the next frames.
+var bufferPool sync.Pool
+
+// AcquireBuffer returns a buffer of n bytes for the payload of a video frame,
+// reused from a released frame when one is large enough.
+func AcquireBuffer(n int) *[]byte {
+	if buf, ok := bufferPool.Get().(*[]byte); ok && cap(*buf) >= n {
+		*buf = (*buf)[:n]
+		return buf
+	}
+	buf := make([]byte, n)
+	return &buf
+}
+
+// ReleaseBuffer puts buf back into the pool. It must not be used afterwards.
+func ReleaseBuffer(buf *[]byte) {
+	bufferPool.Put(buf)
+}
+
+// UnmarshalPooled decodes buf, a buffer from AcquireBuffer, into payload like
+// Unmarshal. A *VideoData or *NaviVideoData keeps buf, whose bytes its Data
+// aliases, until it is released.
+func UnmarshalPooled(buf *[]byte, payload Message) error {
+	if err := Unmarshal(*buf, payload); err != nil {
+		return err
+	}
+	switch payload := payload.(type) {
+	case *VideoData:
+		payload.buf = buf
+	case *NaviVideoData:
+		payload.buf = buf
+	}
+	return nil
+}
+
+// Release returns the buffer of a received frame to the pool; Data must not
+// be used afterwards. Frames that are not released are garbage collected.
+func (m *VideoData) Release() {
+	if m.buf == nil {
+		return
+	}
+	ReleaseBuffer(m.buf)
+	m.buf = nil
+	m.Data = nil
+}
+
+// Release returns the buffer of a received frame to the pool, as
+// VideoData.Release does.
+func (m *NaviVideoData) Release() {
+	(*VideoData)(m).Release()
+}
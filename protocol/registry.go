@@ -0,0 +1,120 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrNilMessage is returned when a factory registered returns no message.
+var ErrNilMessage = errors.New("factory returns a nil message")
+
+// Registry maps the IDs of messages to their types and their types back to
+// the IDs they are marshalled under.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[uint32]func() Message
+	ids       map[reflect.Type]uint32
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[uint32]func() Message),
+		ids:       make(map[reflect.Type]uint32),
+	}
+}
+
+// Register registers the message created by factory under id, replacing the
+// message registered under id before, if any. Messages of the type are
+// marshalled under id from then on, whatever their Type, so that a message
+// can be given the ID of another firmware.
+func (r *Registry) Register(id uint32, factory func() Message) error {
+	msg := factory()
+	if msg == nil {
+		return ErrNilMessage
+	}
+	typ := reflect.TypeOf(msg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.factories[id]; ok {
+		if oldType := reflect.TypeOf(old()); r.ids[oldType] == id {
+			delete(r.ids, oldType)
+		}
+	}
+	r.factories[id] = factory
+	r.ids[typ] = id
+	return nil
+}
+
+// New returns a new message of id, or false when id is not registered.
+func (r *Registry) New(id uint32) (Message, bool) {
+	r.mu.RLock()
+	factory, ok := r.factories[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// ID returns the ID msg is registered under, or false when its type is not
+// registered.
+func (r *Registry) ID(msg Message) (uint32, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.ids[reflect.TypeOf(msg)]
+	return id, ok
+}
+
+// DefaultRegistry holds the messages of the dongle, which GetPayloadByHeader
+// looks up.
+var DefaultRegistry = NewRegistry()
+
+// Register registers the message created by factory under id in
+// DefaultRegistry, such as a message of a vendor firmware.
+func Register(id uint32, factory func() Message) error {
+	return DefaultRegistry.Register(id, factory)
+}
+
+// register registers the message type T of the package in DefaultRegistry
+// under its Type.
+func register[T any, M interface {
+	*T
+	Message
+}]() {
+	if err := Register(M(new(T)).Type(), func() Message { return M(new(T)) }); err != nil {
+		panic(err)
+	}
+}
+
+func init() {
+	register[Open]()
+	register[Plugged]()
+	register[Phase]()
+	register[Unplugged]()
+	register[Touch]()
+	register[VideoData]()
+	register[AudioData]()
+	register[CarPlay]()
+	register[LogoType]()
+	register[BluetoothAddress]()
+	register[BluetoothPIN]()
+	register[BluetoothDeviceName]()
+	register[WifiDeviceName]()
+	register[DisconnectPhone]()
+	register[BluetoothPairedList]()
+	register[ManufacturerInfo]()
+	register[CloseDongle]()
+	register[MultiTouch]()
+	register[HiCarLink]()
+	register[BoxSettings]()
+	register[PeerBluetoothAddress]()
+	register[MediaData]()
+	register[NaviVideoData]()
+	register[SendFile]()
+	register[Heartbeat]()
+	register[UpdateProgress]()
+	register[UpdateState]()
+	register[SoftwareVersion]()
+}
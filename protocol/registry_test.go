@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// vendorMessage is a message unknown to the package, registered by its user.
+type vendorMessage struct {
+	Value uint32
+}
+
+const vendorID = 0xf001
+
+func (*vendorMessage) Type() uint32 { return vendorID }
+
+func (m *vendorMessage) AppendBinary(b []byte) ([]byte, error) {
+	return binary.LittleEndian.AppendUint32(b, m.Value), nil
+}
+
+func (m *vendorMessage) UnmarshalBinary(data []byte) error {
+	if len(data) >= 4 {
+		m.Value = binary.LittleEndian.Uint32(data)
+	}
+	return nil
+}
+
+func TestRegisterVendorMessage(t *testing.T) {
+	if err := Register(vendorID, func() Message { return new(vendorMessage) }); err != nil {
+		t.Fatal(err)
+	}
+	// Other tests go through every message of DefaultRegistry.
+	t.Cleanup(func() {
+		DefaultRegistry.mu.Lock()
+		defer DefaultRegistry.mu.Unlock()
+		delete(DefaultRegistry.factories, vendorID)
+		delete(DefaultRegistry.ids, reflect.TypeOf(new(vendorMessage)))
+	})
+
+	data, err := Marshal(&vendorMessage{Value: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hdr Header
+	if err := Unmarshal(data[:headerSize], &hdr); err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Type != vendorID {
+		t.Errorf("type = %#x, want %#x", hdr.Type, vendorID)
+	}
+	payload := GetPayloadByHeader(hdr)
+	if err := Unmarshal(data[headerSize:], payload); err != nil {
+		t.Fatal(err)
+	}
+	if msg, ok := payload.(*vendorMessage); !ok || msg.Value != 42 {
+		t.Errorf("payload = %#v, want &vendorMessage{Value: 42}", payload)
+	}
+}
+
+// vendorPhase is a vendor message replacing Phase.
+type vendorPhase struct {
+	Phase
+}
+
+func TestRegistryReplace(t *testing.T) {
+	r := NewRegistry()
+	for _, factory := range []func() Message{
+		func() Message { return new(Phase) },
+		func() Message { return new(LogoType) },
+		func() Message { return new(vendorPhase) },
+	} {
+		if err := r.Register(factory().Type(), factory); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if msg, _ := r.New(new(Phase).Type()); msg == nil {
+		t.Errorf("New(Phase) = nil, want a vendorPhase")
+	} else if _, ok := msg.(*vendorPhase); !ok {
+		t.Errorf("New(Phase) = %#v, want a vendorPhase", msg)
+	}
+	if msg, _ := r.New(new(LogoType).Type()); msg == nil {
+		t.Errorf("New(LogoType) = nil, want a LogoType")
+	} else if _, ok := msg.(*LogoType); !ok {
+		t.Errorf("New(LogoType) = %#v, want a LogoType", msg)
+	}
+}
+
+// TestRegisterOtherID registers a message under an ID other than its Type,
+// as a firmware numbering it differently would need.
+func TestRegisterOtherID(t *testing.T) {
+	const otherID = 0xf002
+	r := NewRegistry()
+	if err := r.Register(otherID, func() Message { return new(vendorPhase) }); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := r.New(otherID); msg == nil {
+		t.Errorf("New(%#x) = nil, want a vendorPhase", otherID)
+	}
+	if id, ok := r.ID(new(vendorPhase)); !ok || id != otherID {
+		t.Errorf("ID(vendorPhase) = %#x, %v, want %#x", id, ok, otherID)
+	}
+	if _, ok := r.ID(new(Phase)); ok {
+		t.Errorf("unregistered Phase has an ID")
+	}
+
+	// Replacing the message of the ID drops its type.
+	if err := r.Register(otherID, func() Message { return new(LogoType) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.ID(new(vendorPhase)); ok {
+		t.Errorf("replaced vendorPhase still has an ID")
+	}
+}
+
+func TestRegisterNilMessage(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(1, func() Message { return nil }); !errors.Is(err, ErrNilMessage) {
+		t.Errorf("Register = %v, want ErrNilMessage", err)
+	}
+}
@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomize sets the exported fields of v to random values.
+func randomize(v reflect.Value, rnd *rand.Rand) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				randomize(v.Field(i), rnd)
+			}
+		}
+	case reflect.Pointer:
+		if rnd.Intn(2) == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		randomize(v.Elem(), rnd)
+	case reflect.Slice:
+		n := rnd.Intn(64)
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for i := 0; i < n; i++ {
+			randomize(v.Index(i), rnd)
+		}
+	case reflect.String:
+		b := make([]byte, rnd.Intn(40))
+		for i := range b {
+			b[i] = byte(' ' + rnd.Intn(95))
+		}
+		v.SetString(string(b))
+	case reflect.Bool:
+		v.SetBool(rnd.Intn(2) == 0)
+	case reflect.Int32, reflect.Int64:
+		v.SetInt(rnd.Int63n(1<<31) - 1<<30)
+	case reflect.Uint8, reflect.Uint32:
+		v.SetUint(uint64(rnd.Uint32()) & (1<<(8*v.Type().Size()) - 1))
+	case reflect.Float32:
+		v.SetFloat(float64(rnd.Float32()))
+	default:
+		panic("randomize: unsupported kind " + v.Kind().String())
+	}
+}
+
+// TestRoundTrip encodes random messages of every registered type, decodes
+// them with the type their header tells and encodes them again, which must
+// give the same frame.
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for id, factory := range DefaultRegistry.factories {
+		for i := 0; i < 200; i++ {
+			msg := factory()
+			randomize(reflect.ValueOf(msg).Elem(), rnd)
+
+			frame, err := Marshal(msg)
+			if err != nil {
+				t.Fatalf("marshal %#v: %v", msg, err)
+			}
+			var hdr Header
+			if err := Unmarshal(frame[:headerSize], &hdr); err != nil {
+				t.Fatalf("unmarshal header of %#v: %v", msg, err)
+			}
+			if hdr.Type != id || int(hdr.Length) != len(frame)-headerSize {
+				t.Fatalf("header of %T = %#v, want type %#x and length %d", msg, hdr, id, len(frame)-headerSize)
+			}
+			decoded := GetPayloadByHeader(hdr)
+			if reflect.TypeOf(decoded) != reflect.TypeOf(msg) {
+				t.Fatalf("payload of %#x is %T, want %T", id, decoded, msg)
+			}
+			if err := Unmarshal(frame[headerSize:], decoded); err != nil {
+				t.Fatalf("unmarshal %T: %v", msg, err)
+			}
+			again, err := Marshal(decoded)
+			if err != nil {
+				t.Fatalf("marshal %#v: %v", decoded, err)
+			}
+			if !bytes.Equal(again, frame) {
+				t.Fatalf("round trip of %T\n got %x\nwant %x", msg, again, frame)
+			}
+		}
+	}
+}
+
+// TestRoundTripFields checks that messages whose fields all survive
+// encoding decode to what was encoded.
+func TestRoundTripFields(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	msgs := []Message{
+		new(Open), new(ManufacturerInfo), new(CarPlay), new(Phase), new(Touch),
+		new(LogoType), new(MultiTouch), new(UpdateProgress), new(UpdateState),
+		new(BluetoothDeviceName), new(WifiDeviceName), new(HiCarLink),
+		new(PeerBluetoothAddress),
+	}
+	for _, msg := range msgs {
+		for i := 0; i < 200; i++ {
+			randomize(reflect.ValueOf(msg).Elem(), rnd)
+			data, err := msg.AppendBinary(nil)
+			if err != nil {
+				t.Fatalf("marshal %#v: %v", msg, err)
+			}
+			decoded := reflect.New(reflect.TypeOf(msg).Elem()).Interface().(Message)
+			if err := Unmarshal(data, decoded); err != nil {
+				t.Fatalf("unmarshal %T: %v", msg, err)
+			}
+			if len(data) > 0 && !reflect.DeepEqual(decoded, msg) {
+				t.Fatalf("round trip of %T\n got %#v\nwant %#v", msg, decoded, msg)
+			}
+		}
+	}
+}
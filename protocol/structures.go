@@ -26,7 +26,7 @@ type ManufacturerInfo struct {
 }
 
 type CarPlay struct {
-	Type CarPlayType `struc:"int32,little"`
+	Command CarPlayType `struc:"int32,little"`
 }
 
 type SoftwareVersion struct {
@@ -41,15 +41,23 @@ type BluetoothPIN struct {
 	Address NullTermString `struc:"[4]byte"`
 }
 
+// Plugged reports a phone connected to the dongle. Wifi is set when it is
+// connected wirelessly, which the dongle tells with a second int32.
 type Plugged struct {
-	PhoneType int  `struc:"int32,little"`
-	Wifi      bool `struc:"skip"`
-	// FIXME: Send WifiParam only when no wifi is ok
+	PhoneType PhoneType `struc:"int32,little"`
+	Wifi      bool      `struc:"skip"`
+}
+
+// Phase reports the progress of the phone connection.
+type Phase struct {
+	Phase int32 `struc:"int32,little"`
 }
 
 type Unplugged struct {
 }
 
+// VideoData is a frame of H.264 video. Received frames hold the pooled buffer
+// Data aliases until Release is called.
 type VideoData struct {
 	Width    int32  `struc:"int32,little"`
 	Height   int32  `struc:"int32,little"`
@@ -57,6 +65,8 @@ type VideoData struct {
 	Length   int32  `struc:"int32,little,sizeof=Data"`
 	Unknown2 int32  `struc:"int32,little"`
 	Data     []byte `struc:"[]byte"`
+
+	buf *[]byte `struc:"skip"`
 }
 
 type AudioData struct {
@@ -75,8 +85,18 @@ type Touch struct {
 	Flags  uint32      `struc:"int32,little"`
 }
 
+// MultiTouch is a touch of several fingers, one TouchPoint per finger.
 type MultiTouch struct {
-	// TODO: Implement
+	Touches []TouchPoint `struc:"skip"`
+}
+
+// TouchPoint is a finger of a MultiTouch, at X and Y relative to the screen
+// from 0 to 1. Action is 0 for up, 1 for down and 2 for move.
+type TouchPoint struct {
+	X      float32 `struc:"float32,little"`
+	Y      float32 `struc:"float32,little"`
+	Action int32   `struc:"int32,little"`
+	ID     uint32  `struc:"uint32,little"`
 }
 
 type BluetoothDeviceName struct {
@@ -91,7 +111,111 @@ type BluetoothPairedList struct {
 	Data NullTermString `struc:"skip"`
 }
 
+// LogoType selects the logo the dongle shows while no phone is connected.
+type LogoType struct {
+	Logo int32 `struc:"int32,little"`
+}
+
+// DisconnectPhone asks the dongle to disconnect the phone.
+type DisconnectPhone struct {
+}
+
+// CloseDongle asks the dongle to stop the session.
+type CloseDongle struct {
+}
+
+// HiCarLink is the link a Huawei phone connects to with HiCar.
+type HiCarLink struct {
+	Link NullTermString `struc:"skip"`
+}
+
+// BoxSettings is the configuration of the dongle, encoded as JSON, which
+// newer firmwares accept. The dongle replies with its own settings, which have
+// more fields than are known here; Raw holds them all.
+type BoxSettings struct {
+	// SyncTime is the time of the head unit in seconds since the Unix epoch.
+	SyncTime int64 `json:"syncTime,omitempty" struc:"skip"`
+	// MediaDelay is the audio buffering of the dongle in milliseconds.
+	MediaDelay        int32  `json:"mediaDelay,omitempty" struc:"skip"`
+	AndroidAutoWidth  int32  `json:"androidAutoSizeW,omitempty" struc:"skip"`
+	AndroidAutoHeight int32  `json:"androidAutoSizeH,omitempty" struc:"skip"`
+	WifiChannel       int32  `json:"WiFiChannel,omitempty" struc:"skip"`
+	MicType           int32  `json:"micType,omitempty" struc:"skip"`
+	BoxName           string `json:"boxName,omitempty" struc:"skip"`
+	// Devices are the phones paired with the dongle. Nil leaves them as they are.
+	Devices *[]BoxDevice `json:"DevList,omitempty" struc:"skip"`
+	// NaviScreen enables the navigation video with its size and frame rate.
+	NaviScreen *NaviScreenInfo `json:"naviScreenInfo,omitempty" struc:"skip"`
+
+	// Set by the dongle in its replies.
+	UUID            string `json:"uuid,omitempty" struc:"skip"`
+	ProductType     string `json:"productType,omitempty" struc:"skip"`
+	HardwareVersion string `json:"hwVersion,omitempty" struc:"skip"`
+
+	Raw []byte `json:"-" struc:"skip"`
+}
+
+// PeerBluetoothAddress is the Bluetooth address of the connected phone.
+type PeerBluetoothAddress struct {
+	Address NullTermString `struc:"skip"`
+}
+
+// MediaData is information about the media playing on the phone; Data is
+// JSON metadata or album art as MediaType tells.
+type MediaData struct {
+	MediaType MediaType `struc:"int32,little"`
+	Data      []byte    `struc:"skip"`
+}
+
+// NaviScreenInfo is the screen the navigation video is sent for, such as an
+// instrument cluster or a head-up display.
+type NaviScreenInfo struct {
+	Width  int32 `json:"width"`
+	Height int32 `json:"height"`
+	FPS    int32 `json:"fps"`
+}
+
+// BoxDevice is a phone paired with the dongle, as listed in BoxSettings.
+type BoxDevice struct {
+	ID   string `json:"id"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// MediaInfo is the metadata of the media playing on the phone, sent as
+// MediaData of MediaTypeData. The dongle sends only the fields that changed.
+type MediaInfo struct {
+	Title  string `json:"MediaSongName,omitempty"`
+	Artist string `json:"MediaArtistName,omitempty"`
+	Album  string `json:"MediaAlbumName,omitempty"`
+	App    string `json:"MediaAPPName,omitempty"`
+	// Duration and Position are in milliseconds.
+	Duration int64 `json:"MediaSongDuration,omitempty"`
+	Position int64 `json:"MediaSongPlayTime,omitempty"`
+}
+
+// AlbumArt is the album art of the media playing on the phone, sent as
+// MediaData of MediaTypeAlbumArt. Data is usually a JPEG image.
+type AlbumArt struct {
+	Data []byte
+}
+
+// NaviVideoData is a frame of the navigation video, sent to instrument
+// clusters and head-up displays besides the main screen.
+type NaviVideoData VideoData
+
+// UpdateProgress is the progress of a firmware update in percent.
+type UpdateProgress struct {
+	Progress int32 `struc:"int32,little"`
+}
+
+// UpdateState is the state of a firmware update.
+type UpdateState struct {
+	State int32 `struc:"int32,little"`
+}
+
+// Unknown is a message of an ID that is not registered.
 type Unknown struct {
-	Type uint32 `struc:"skip"`
+	ID   uint32 `struc:"skip"`
 	Data []byte `struc:"skip"`
 }
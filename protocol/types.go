@@ -10,32 +10,79 @@ import (
 type CarPlayType uint32
 
 const (
-	Invalid           = CarPlayType(0)
-	BtnSiri           = CarPlayType(5)
-	CarMicrophone     = CarPlayType(7)
-	BtnLeft           = CarPlayType(100)
-	BtnRight          = CarPlayType(101)
-	BtnSelectDown     = CarPlayType(104)
-	BtnSelectUp       = CarPlayType(105)
-	BtnBack           = CarPlayType(106)
-	BtnDown           = CarPlayType(114)
-	BtnHome           = CarPlayType(200)
-	BtnPlay           = CarPlayType(201)
-	BtnPause          = CarPlayType(202)
-	BtnNextTrack      = CarPlayType(204)
-	BtnPrevTrack      = CarPlayType(205)
-	SupportWifi       = CarPlayType(1000)
-	SupportWifiNeedKo = CarPlayType(1012)
+	Invalid             = CarPlayType(0)
+	StartRecordAudio    = CarPlayType(1)
+	StopRecordAudio     = CarPlayType(2)
+	RequestHostUI       = CarPlayType(3)
+	BtnSiri             = CarPlayType(5)
+	CarMicrophone       = CarPlayType(7)
+	RequestKeyFrame     = CarPlayType(12)
+	BoxMicrophone       = CarPlayType(15)
+	EnableNightMode     = CarPlayType(16)
+	DisableNightMode    = CarPlayType(17)
+	AudioTransferOn     = CarPlayType(22)
+	AudioTransferOff    = CarPlayType(23)
+	Wifi24G             = CarPlayType(24)
+	Wifi5G              = CarPlayType(25)
+	BtnLeft             = CarPlayType(100)
+	BtnRight            = CarPlayType(101)
+	BtnSelectDown       = CarPlayType(104)
+	BtnSelectUp         = CarPlayType(105)
+	BtnBack             = CarPlayType(106)
+	BtnUp               = CarPlayType(113)
+	BtnDown             = CarPlayType(114)
+	BtnHome             = CarPlayType(200)
+	BtnPlay             = CarPlayType(201)
+	BtnPause            = CarPlayType(202)
+	BtnNextTrack        = CarPlayType(204)
+	BtnPrevTrack        = CarPlayType(205)
+	RequestVideoFocus   = CarPlayType(500)
+	ReleaseVideoFocus   = CarPlayType(501)
+	SupportWifi         = CarPlayType(1000)
+	AutoConnectEnable   = CarPlayType(1001)
+	WifiConnect         = CarPlayType(1002)
+	ScanningDevice      = CarPlayType(1003)
+	DeviceFound         = CarPlayType(1004)
+	DeviceNotFound      = CarPlayType(1005)
+	ConnectDeviceFailed = CarPlayType(1006)
+	BtConnected         = CarPlayType(1007)
+	BtDisconnected      = CarPlayType(1008)
+	WifiConnected       = CarPlayType(1009)
+	WifiDisconnected    = CarPlayType(1010)
+	BtPairStart         = CarPlayType(1011)
+	SupportWifiNeedKo   = CarPlayType(1012)
 )
 
 func (c CarPlayType) GoString() string {
 	switch c {
 	case 0:
 		return "Invalid"
+	case 1:
+		return "StartRecordAudio"
+	case 2:
+		return "StopRecordAudio"
+	case 3:
+		return "RequestHostUI"
 	case 5:
 		return "BtnSiri"
 	case 7:
 		return "CarMicrophone"
+	case 12:
+		return "RequestKeyFrame"
+	case 15:
+		return "BoxMicrophone"
+	case 16:
+		return "EnableNightMode"
+	case 17:
+		return "DisableNightMode"
+	case 22:
+		return "AudioTransferOn"
+	case 23:
+		return "AudioTransferOff"
+	case 24:
+		return "Wifi24G"
+	case 25:
+		return "Wifi5G"
 	case 100:
 		return "BtnLeft"
 	case 101:
@@ -46,6 +93,8 @@ func (c CarPlayType) GoString() string {
 		return "BtnSelectUp"
 	case 106:
 		return "BtnBack"
+	case 113:
+		return "BtnUp"
 	case 114:
 		return "BtnDown"
 	case 200:
@@ -58,8 +107,34 @@ func (c CarPlayType) GoString() string {
 		return "BtnNextTrack"
 	case 205:
 		return "BtnPrevTrack"
+	case 500:
+		return "RequestVideoFocus"
+	case 501:
+		return "ReleaseVideoFocus"
 	case 1000:
 		return "SupportWifi"
+	case 1001:
+		return "AutoConnectEnable"
+	case 1002:
+		return "WifiConnect"
+	case 1003:
+		return "ScanningDevice"
+	case 1004:
+		return "DeviceFound"
+	case 1005:
+		return "DeviceNotFound"
+	case 1006:
+		return "ConnectDeviceFailed"
+	case 1007:
+		return "BtConnected"
+	case 1008:
+		return "BtDisconnected"
+	case 1009:
+		return "WifiConnected"
+	case 1010:
+		return "WifiDisconnected"
+	case 1011:
+		return "BtPairStart"
 	case 1012:
 		return "SupportWifiNeedKo"
 	}
@@ -80,6 +155,8 @@ const (
 	AudioSiriStop       = AudioCommand(0x09)
 	AudioMediaStart     = AudioCommand(0x0a)
 	AudioMediaStop      = AudioCommand(0x0b)
+	AudioAlertStart     = AudioCommand(0x0c)
+	AudioAlertStop      = AudioCommand(0x0d)
 )
 
 func (c AudioCommand) GoString() string {
@@ -106,6 +183,10 @@ func (c AudioCommand) GoString() string {
 		return "AudioMediaStart"
 	case 0x0b:
 		return "AudioMediaStop"
+	case 0x0c:
+		return "AudioAlertStart"
+	case 0x0d:
+		return "AudioAlertStop"
 	}
 	return fmt.Sprintf("Unknown(%d)", c)
 }
@@ -135,6 +216,52 @@ const (
 	TouchUp   = TouchAction(16)
 )
 
+type PhoneType uint32
+
+const (
+	PhoneTypeAndroidMirror = PhoneType(1)
+	PhoneTypeCarPlay       = PhoneType(3)
+	PhoneTypeIPhoneMirror  = PhoneType(4)
+	PhoneTypeAndroidAuto   = PhoneType(5)
+	PhoneTypeHiCar         = PhoneType(6)
+)
+
+func (t PhoneType) GoString() string {
+	switch t {
+	case 1:
+		return "PhoneTypeAndroidMirror"
+	case 3:
+		return "PhoneTypeCarPlay"
+	case 4:
+		return "PhoneTypeIPhoneMirror"
+	case 5:
+		return "PhoneTypeAndroidAuto"
+	case 6:
+		return "PhoneTypeHiCar"
+	}
+	return fmt.Sprintf("Unknown(%d)", t)
+}
+
+// PhaseIdle is the Phase reported when no phone is connected.
+const PhaseIdle = int32(0)
+
+type MediaType uint32
+
+const (
+	MediaTypeData     = MediaType(1)
+	MediaTypeAlbumArt = MediaType(3)
+)
+
+func (t MediaType) GoString() string {
+	switch t {
+	case 1:
+		return "MediaTypeData"
+	case 3:
+		return "MediaTypeAlbumArt"
+	}
+	return fmt.Sprintf("Unknown(%d)", t)
+}
+
 type NullTermString string
 
 func (s NullTermString) GoString() string {
@@ -0,0 +1,12 @@
+package recorder
+
+import "errors"
+
+var (
+	ErrEmptyDir       = errors.New("empty dir")
+	ErrUnknownFormat  = errors.New("unknown format")
+	ErrEmptyFPS       = errors.New("empty fps")
+	ErrAlreadyStarted = errors.New("recording already started")
+	ErrNotStarted     = errors.New("recording not started")
+	ErrInvalidAudio   = errors.New("invalid audio format")
+)
@@ -0,0 +1,82 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	naluTypeIDR = 5
+	naluTypeSPS = 7
+	naluTypePPS = 8
+	naluTypeAUD = 9
+)
+
+// splitAnnexB splits an H.264 Annex-B byte stream into NAL units without start codes.
+func splitAnnexB(data []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nalus = append(nalus, bytes.TrimRight(data[start:i], "\x00"))
+		}
+		i += 2
+		start = i + 1
+	}
+	if start >= 0 && start < len(data) {
+		nalus = append(nalus, data[start:])
+	}
+	return nalus
+}
+
+// accessUnit is an H.264 access unit converted for storage in a container.
+type accessUnit struct {
+	// avcc holds the NAL units with 4 byte big endian length prefixes.
+	avcc []byte
+	sps  []byte
+	pps  []byte
+	key  bool
+}
+
+// parseAccessUnit strips parameter sets and delimiters from an Annex-B access unit
+// and returns the remaining NAL units length prefixed.
+func parseAccessUnit(data []byte) accessUnit {
+	var au accessUnit
+	for _, nalu := range splitAnnexB(data) {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch nalu[0] & 0x1f {
+		case naluTypeSPS:
+			au.sps = nalu
+			continue
+		case naluTypePPS:
+			au.pps = nalu
+			continue
+		case naluTypeAUD:
+			continue
+		case naluTypeIDR:
+			au.key = true
+		}
+		au.avcc = binary.BigEndian.AppendUint32(au.avcc, uint32(len(nalu)))
+		au.avcc = append(au.avcc, nalu...)
+	}
+	return au
+}
+
+// avcDecoderConfig builds an AVCDecoderConfigurationRecord (ISO/IEC 14496-15) from
+// a single SPS and PPS.
+func avcDecoderConfig(sps, pps []byte) []byte {
+	if len(sps) < 4 {
+		return nil
+	}
+	buf := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(sps)))
+	buf = append(buf, sps...)
+	buf = append(buf, 1)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(pps)))
+	return append(buf, pps...)
+}
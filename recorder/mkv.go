@@ -0,0 +1,237 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	mkvIDEBML               = 0x1a45dfa3
+	mkvIDEBMLVersion        = 0x4286
+	mkvIDEBMLReadVersion    = 0x42f7
+	mkvIDEBMLMaxIDLength    = 0x42f2
+	mkvIDEBMLMaxSizeLength  = 0x42f3
+	mkvIDDocType            = 0x4282
+	mkvIDDocTypeVersion     = 0x4287
+	mkvIDDocTypeReadVersion = 0x4285
+	mkvIDSegment            = 0x18538067
+	mkvIDInfo               = 0x1549a966
+	mkvIDTimestampScale     = 0x2ad7b1
+	mkvIDMuxingApp          = 0x4d80
+	mkvIDWritingApp         = 0x5741
+	mkvIDTracks             = 0x1654ae6b
+	mkvIDTrackEntry         = 0xae
+	mkvIDTrackNumber        = 0xd7
+	mkvIDTrackUID           = 0x73c5
+	mkvIDTrackType          = 0x83
+	mkvIDFlagLacing         = 0x9c
+	mkvIDCodecID            = 0x86
+	mkvIDCodecPrivate       = 0x63a2
+	mkvIDVideo              = 0xe0
+	mkvIDPixelWidth         = 0xb0
+	mkvIDPixelHeight        = 0xba
+	mkvIDAudio              = 0xe1
+	mkvIDSamplingFrequency  = 0xb5
+	mkvIDChannels           = 0x9f
+	mkvIDBitDepth           = 0x6264
+	mkvIDCluster            = 0x1f43b675
+	mkvIDTimestamp          = 0xe7
+	mkvIDSimpleBlock        = 0xa3
+
+	mkvVideoTrack = 1
+	mkvAudioTrack = 2
+
+	// mkvClusterDuration is how much media is buffered before a cluster is written.
+	mkvClusterDuration = time.Second
+)
+
+// mkvMuxer writes Matroska with one H.264 track and one 16 bit little endian PCM track.
+// Timestamps are in milliseconds.
+type mkvMuxer struct {
+	w   io.Writer
+	cfg trackConfig
+
+	cluster      []byte
+	clusterStart time.Duration
+	clusterOpen  bool
+
+	audioStarted bool
+	audioStart   time.Duration
+	audioFrames  uint64
+	frameSize    int
+}
+
+func newMKVMuxer(w io.Writer, cfg trackConfig) (*mkvMuxer, error) {
+	if cfg.audio.Frequency == 0 || cfg.audio.Channel == 0 {
+		return nil, ErrInvalidAudio
+	}
+	m := &mkvMuxer{
+		w:         w,
+		cfg:       cfg,
+		frameSize: int(cfg.audio.Channel) * int(cfg.audio.Bitrate/8),
+	}
+	if _, err := w.Write(m.header()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *mkvMuxer) writeVideo(pts time.Duration, au accessUnit) error {
+	return m.writeBlock(mkvVideoTrack, pts, au.avcc, au.key)
+}
+
+func (m *mkvMuxer) writeAudio(pts time.Duration, pcm []byte) error {
+	pcm = pcm[:len(pcm)-len(pcm)%m.frameSize]
+	if len(pcm) == 0 {
+		return nil
+	}
+	// Audio timestamps follow the sample count so that arrival jitter does not
+	// show up as gaps, unless the stream was actually interrupted.
+	expected := m.audioStart + time.Duration(m.audioFrames)*time.Second/time.Duration(m.cfg.audio.Frequency)
+	if !m.audioStarted || pts > expected+audioGap {
+		m.audioStarted = true
+		m.audioStart = pts
+		m.audioFrames = 0
+		expected = pts
+	}
+	m.audioFrames += uint64(len(pcm) / m.frameSize)
+	return m.writeBlock(mkvAudioTrack, expected, pcm, true)
+}
+
+func (m *mkvMuxer) writeBlock(track byte, pts time.Duration, data []byte, key bool) error {
+	rel := (pts - m.clusterStart).Milliseconds()
+	if m.clusterOpen && (pts-m.clusterStart >= mkvClusterDuration || rel > math.MaxInt16 || rel < math.MinInt16) {
+		if err := m.flush(); err != nil {
+			return err
+		}
+	}
+	if !m.clusterOpen {
+		m.clusterOpen = true
+		m.clusterStart = pts
+		m.cluster = appendEBMLUint(m.cluster[:0], mkvIDTimestamp, uint64(pts.Milliseconds()))
+		rel = 0
+	}
+
+	block := []byte{0x80 | track}
+	block = binary.BigEndian.AppendUint16(block, uint16(int16(rel)))
+	if key {
+		block = append(block, 0x80)
+	} else {
+		block = append(block, 0)
+	}
+	block = append(block, data...)
+	m.cluster = appendEBML(m.cluster, mkvIDSimpleBlock, block)
+	return nil
+}
+
+func (m *mkvMuxer) flush() error {
+	if !m.clusterOpen {
+		return nil
+	}
+	m.clusterOpen = false
+	_, err := m.w.Write(appendEBML(nil, mkvIDCluster, m.cluster))
+	return err
+}
+
+func (m *mkvMuxer) Close() error {
+	return m.flush()
+}
+
+func (m *mkvMuxer) header() []byte {
+	var ebml []byte
+	ebml = appendEBMLUint(ebml, mkvIDEBMLVersion, 1)
+	ebml = appendEBMLUint(ebml, mkvIDEBMLReadVersion, 1)
+	ebml = appendEBMLUint(ebml, mkvIDEBMLMaxIDLength, 4)
+	ebml = appendEBMLUint(ebml, mkvIDEBMLMaxSizeLength, 8)
+	ebml = appendEBML(ebml, mkvIDDocType, []byte("matroska"))
+	ebml = appendEBMLUint(ebml, mkvIDDocTypeVersion, 4)
+	ebml = appendEBMLUint(ebml, mkvIDDocTypeReadVersion, 2)
+	b := appendEBML(nil, mkvIDEBML, ebml)
+
+	// The segment is written with an unknown size so that it can be streamed.
+	b = appendEBMLID(b, mkvIDSegment)
+	b = append(b, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+
+	var info []byte
+	info = appendEBMLUint(info, mkvIDTimestampScale, uint64(time.Millisecond))
+	info = appendEBML(info, mkvIDMuxingApp, []byte("gocarplay"))
+	info = appendEBML(info, mkvIDWritingApp, []byte("gocarplay"))
+	b = appendEBML(b, mkvIDInfo, info)
+
+	var video []byte
+	video = appendEBMLUint(video, mkvIDTrackNumber, mkvVideoTrack)
+	video = appendEBMLUint(video, mkvIDTrackUID, mkvVideoTrack)
+	video = appendEBMLUint(video, mkvIDTrackType, 1)
+	video = appendEBMLUint(video, mkvIDFlagLacing, 0)
+	video = appendEBML(video, mkvIDCodecID, []byte("V_MPEG4/ISO/AVC"))
+	video = appendEBML(video, mkvIDCodecPrivate, m.cfg.avcC)
+	var videoSettings []byte
+	videoSettings = appendEBMLUint(videoSettings, mkvIDPixelWidth, uint64(m.cfg.width))
+	videoSettings = appendEBMLUint(videoSettings, mkvIDPixelHeight, uint64(m.cfg.height))
+	video = appendEBML(video, mkvIDVideo, videoSettings)
+
+	var audio []byte
+	audio = appendEBMLUint(audio, mkvIDTrackNumber, mkvAudioTrack)
+	audio = appendEBMLUint(audio, mkvIDTrackUID, mkvAudioTrack)
+	audio = appendEBMLUint(audio, mkvIDTrackType, 2)
+	audio = appendEBMLUint(audio, mkvIDFlagLacing, 0)
+	audio = appendEBML(audio, mkvIDCodecID, []byte("A_PCM/INT/LIT"))
+	var audioSettings []byte
+	audioSettings = appendEBML(audioSettings, mkvIDSamplingFrequency, binary.BigEndian.AppendUint64(nil, math.Float64bits(float64(m.cfg.audio.Frequency))))
+	audioSettings = appendEBMLUint(audioSettings, mkvIDChannels, uint64(m.cfg.audio.Channel))
+	audioSettings = appendEBMLUint(audioSettings, mkvIDBitDepth, uint64(m.cfg.audio.Bitrate))
+	audio = appendEBML(audio, mkvIDAudio, audioSettings)
+
+	var tracks []byte
+	tracks = appendEBML(tracks, mkvIDTrackEntry, video)
+	tracks = appendEBML(tracks, mkvIDTrackEntry, audio)
+	return appendEBML(b, mkvIDTracks, tracks)
+}
+
+func appendEBMLID(b []byte, id uint32) []byte {
+	switch {
+	case id > 0xffffff:
+		return append(b, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xffff:
+		return append(b, byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xff:
+		return append(b, byte(id>>8), byte(id))
+	}
+	return append(b, byte(id))
+}
+
+// appendEBMLSize appends size as a variable length integer of the shortest width.
+func appendEBMLSize(b []byte, size uint64) []byte {
+	n := 1
+	for n < 8 && size >= 1<<(7*n)-1 {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		v := byte(size >> (8 * i))
+		if i == n-1 {
+			v |= 1 << (8 - n)
+		}
+		b = append(b, v)
+	}
+	return b
+}
+
+func appendEBML(b []byte, id uint32, data []byte) []byte {
+	b = appendEBMLID(b, id)
+	b = appendEBMLSize(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendEBMLUint(b []byte, id uint32, v uint64) []byte {
+	n := 1
+	for n < 8 && v>>(8*n) != 0 {
+		n++
+	}
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(v >> (8 * (n - 1 - i)))
+	}
+	return appendEBML(b, id, data)
+}
@@ -0,0 +1,399 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	mp4VideoTrackID   = 1
+	mp4AudioTrackID   = 2
+	mp4VideoTimescale = 90000
+	mp4MovieTimescale = 1000
+
+	// mp4FragmentDuration is how much media is buffered before a fragment is written.
+	mp4FragmentDuration = time.Second
+
+	mp4SampleFlagsKey    = 0x02000000
+	mp4SampleFlagsNonKey = 0x01010000
+)
+
+var mp4Matrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+type mp4Sample struct {
+	decodeTime uint64
+	data       []byte
+	key        bool
+}
+
+// mp4Muxer writes fragmented MP4 with one H.264 track and one 16 bit little endian PCM track.
+type mp4Muxer struct {
+	w   io.Writer
+	cfg trackConfig
+	seq uint32
+
+	video         []mp4Sample
+	fragmentStart time.Duration
+
+	audio          []byte
+	audioStarted   bool
+	audioBase      uint64
+	audioFrameSize int
+}
+
+func newMP4Muxer(w io.Writer, cfg trackConfig) (*mp4Muxer, error) {
+	if cfg.audio.Frequency == 0 || cfg.audio.Channel == 0 {
+		return nil, ErrInvalidAudio
+	}
+	m := &mp4Muxer{
+		w:              w,
+		cfg:            cfg,
+		audioFrameSize: int(cfg.audio.Channel) * int(cfg.audio.Bitrate/8),
+	}
+	if _, err := w.Write(m.initSegment()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *mp4Muxer) writeVideo(pts time.Duration, au accessUnit) error {
+	if pts-m.fragmentStart >= mp4FragmentDuration {
+		if err := m.flush(); err != nil {
+			return err
+		}
+		m.fragmentStart = pts
+	}
+	m.video = append(m.video, mp4Sample{decodeTime: scale(pts, mp4VideoTimescale), data: au.avcc, key: au.key})
+	return nil
+}
+
+func (m *mp4Muxer) writeAudio(pts time.Duration, pcm []byte) error {
+	pcm = pcm[:len(pcm)-len(pcm)%m.audioFrameSize]
+	if len(pcm) == 0 {
+		return nil
+	}
+	rate := uint64(m.cfg.audio.Frequency)
+	t := scale(pts, rate)
+	next := m.audioBase + uint64(len(m.audio)/m.audioFrameSize)
+	if !m.audioStarted || t > next+scale(audioGap, rate) {
+		if len(m.audio) > 0 {
+			if err := m.flush(); err != nil {
+				return err
+			}
+		}
+		m.audioStarted = true
+		m.audioBase = t
+	}
+	m.audio = append(m.audio, pcm...)
+	return nil
+}
+
+func (m *mp4Muxer) Close() error {
+	return m.flushAll()
+}
+
+// flush writes all buffered samples except the last video sample, whose duration
+// is not known until the next one arrives.
+func (m *mp4Muxer) flush() error {
+	if len(m.video) < 2 && len(m.audio) == 0 {
+		return nil
+	}
+	var video []mp4Sample
+	var durations []uint32
+	if len(m.video) >= 2 {
+		video = m.video[:len(m.video)-1]
+		for i := range video {
+			durations = append(durations, uint32(m.video[i+1].decodeTime-m.video[i].decodeTime))
+		}
+	}
+	if err := m.writeFragment(video, durations); err != nil {
+		return err
+	}
+	if len(video) > 0 {
+		m.video = m.video[len(video):]
+	}
+	return nil
+}
+
+func (m *mp4Muxer) flushAll() error {
+	if len(m.video) == 0 && len(m.audio) == 0 {
+		return nil
+	}
+	var durations []uint32
+	for i := range m.video {
+		var d uint32
+		if i+1 < len(m.video) {
+			d = uint32(m.video[i+1].decodeTime - m.video[i].decodeTime)
+		} else if i > 0 {
+			d = durations[i-1]
+		} else {
+			d = mp4VideoTimescale / 25
+		}
+		durations = append(durations, d)
+	}
+	err := m.writeFragment(m.video, durations)
+	m.video = nil
+	return err
+}
+
+func (m *mp4Muxer) writeFragment(video []mp4Sample, durations []uint32) error {
+	m.seq++
+	audioFrames := uint32(len(m.audio) / m.audioFrameSize)
+
+	var videoSize int
+	for _, s := range video {
+		videoSize += len(s.data)
+	}
+
+	// The trun data offsets are relative to the start of moof, so the box is built
+	// once to learn its size and the offsets are patched afterwards.
+	var videoOffsetPos, audioOffsetPos int
+	moof := appendBox(nil, "moof", func(b []byte) []byte {
+		b = appendFullBox(b, "mfhd", 0, 0, func(b []byte) []byte {
+			return binary.BigEndian.AppendUint32(b, m.seq)
+		})
+		if len(video) > 0 {
+			b = appendBox(b, "traf", func(b []byte) []byte {
+				b = appendFullBox(b, "tfhd", 0, 0x020000, func(b []byte) []byte {
+					return binary.BigEndian.AppendUint32(b, mp4VideoTrackID)
+				})
+				b = appendFullBox(b, "tfdt", 1, 0, func(b []byte) []byte {
+					return binary.BigEndian.AppendUint64(b, video[0].decodeTime)
+				})
+				return appendFullBox(b, "trun", 0, 0x000701, func(b []byte) []byte {
+					b = binary.BigEndian.AppendUint32(b, uint32(len(video)))
+					videoOffsetPos = len(b)
+					b = binary.BigEndian.AppendUint32(b, 0)
+					for i, s := range video {
+						flags := uint32(mp4SampleFlagsNonKey)
+						if s.key {
+							flags = mp4SampleFlagsKey
+						}
+						b = binary.BigEndian.AppendUint32(b, durations[i])
+						b = binary.BigEndian.AppendUint32(b, uint32(len(s.data)))
+						b = binary.BigEndian.AppendUint32(b, flags)
+					}
+					return b
+				})
+			})
+		}
+		if audioFrames > 0 {
+			b = appendBox(b, "traf", func(b []byte) []byte {
+				b = appendFullBox(b, "tfhd", 0, 0x020018, func(b []byte) []byte {
+					b = binary.BigEndian.AppendUint32(b, mp4AudioTrackID)
+					b = binary.BigEndian.AppendUint32(b, 1)
+					return binary.BigEndian.AppendUint32(b, uint32(m.audioFrameSize))
+				})
+				b = appendFullBox(b, "tfdt", 1, 0, func(b []byte) []byte {
+					return binary.BigEndian.AppendUint64(b, m.audioBase)
+				})
+				return appendFullBox(b, "trun", 0, 0x000001, func(b []byte) []byte {
+					b = binary.BigEndian.AppendUint32(b, audioFrames)
+					audioOffsetPos = len(b)
+					return binary.BigEndian.AppendUint32(b, 0)
+				})
+			})
+		}
+		return b
+	})
+	if len(video) > 0 {
+		binary.BigEndian.PutUint32(moof[videoOffsetPos:], uint32(len(moof)+8))
+	}
+	if audioFrames > 0 {
+		binary.BigEndian.PutUint32(moof[audioOffsetPos:], uint32(len(moof)+8+videoSize))
+	}
+
+	buf := binary.BigEndian.AppendUint32(moof, uint32(8+videoSize+len(m.audio)))
+	buf = append(buf, "mdat"...)
+	for _, s := range video {
+		buf = append(buf, s.data...)
+	}
+	buf = append(buf, m.audio...)
+
+	m.audioBase += uint64(audioFrames)
+	m.audio = m.audio[:0]
+
+	_, err := m.w.Write(buf)
+	return err
+}
+
+func (m *mp4Muxer) initSegment() []byte {
+	b := appendBox(nil, "ftyp", func(b []byte) []byte {
+		b = append(b, "iso5"...)
+		b = binary.BigEndian.AppendUint32(b, 0x200)
+		return append(b, "iso5iso6mp41"...)
+	})
+	return appendBox(b, "moov", func(b []byte) []byte {
+		b = appendFullBox(b, "mvhd", 0, 0, func(b []byte) []byte {
+			b = append(b, make([]byte, 8)...) // creation and modification time
+			b = binary.BigEndian.AppendUint32(b, mp4MovieTimescale)
+			b = binary.BigEndian.AppendUint32(b, 0)          // duration
+			b = binary.BigEndian.AppendUint32(b, 0x00010000) // rate
+			b = binary.BigEndian.AppendUint16(b, 0x0100)     // volume
+			b = append(b, make([]byte, 10)...)
+			b = appendMatrix(b)
+			b = append(b, make([]byte, 24)...)
+			return binary.BigEndian.AppendUint32(b, mp4AudioTrackID+1)
+		})
+		b = m.appendTrack(b, mp4VideoTrackID)
+		b = m.appendTrack(b, mp4AudioTrackID)
+		return appendBox(b, "mvex", func(b []byte) []byte {
+			for _, id := range []uint32{mp4VideoTrackID, mp4AudioTrackID} {
+				b = appendFullBox(b, "trex", 0, 0, func(b []byte) []byte {
+					b = binary.BigEndian.AppendUint32(b, id)
+					b = binary.BigEndian.AppendUint32(b, 1)
+					return append(b, make([]byte, 12)...)
+				})
+			}
+			return b
+		})
+	})
+}
+
+func (m *mp4Muxer) appendTrack(b []byte, id uint32) []byte {
+	video := id == mp4VideoTrackID
+	return appendBox(b, "trak", func(b []byte) []byte {
+		b = appendFullBox(b, "tkhd", 0, 3, func(b []byte) []byte {
+			b = append(b, make([]byte, 8)...)
+			b = binary.BigEndian.AppendUint32(b, id)
+			b = append(b, make([]byte, 4+4+8+2+2)...) // reserved, duration, reserved, layer, alternate group
+			if video {
+				b = binary.BigEndian.AppendUint16(b, 0)
+			} else {
+				b = binary.BigEndian.AppendUint16(b, 0x0100)
+			}
+			b = append(b, 0, 0)
+			b = appendMatrix(b)
+			if video {
+				b = binary.BigEndian.AppendUint32(b, uint32(m.cfg.width)<<16)
+				return binary.BigEndian.AppendUint32(b, uint32(m.cfg.height)<<16)
+			}
+			return append(b, make([]byte, 8)...)
+		})
+		return appendBox(b, "mdia", func(b []byte) []byte {
+			b = appendFullBox(b, "mdhd", 0, 0, func(b []byte) []byte {
+				b = append(b, make([]byte, 8)...)
+				if video {
+					b = binary.BigEndian.AppendUint32(b, mp4VideoTimescale)
+				} else {
+					b = binary.BigEndian.AppendUint32(b, uint32(m.cfg.audio.Frequency))
+				}
+				b = binary.BigEndian.AppendUint32(b, 0)
+				b = binary.BigEndian.AppendUint16(b, 0x55c4) // "und"
+				return append(b, 0, 0)
+			})
+			b = appendFullBox(b, "hdlr", 0, 0, func(b []byte) []byte {
+				b = append(b, make([]byte, 4)...)
+				if video {
+					b = append(b, "vide"...)
+				} else {
+					b = append(b, "soun"...)
+				}
+				b = append(b, make([]byte, 12)...)
+				if video {
+					return append(b, "VideoHandler\x00"...)
+				}
+				return append(b, "SoundHandler\x00"...)
+			})
+			return appendBox(b, "minf", func(b []byte) []byte {
+				if video {
+					b = appendFullBox(b, "vmhd", 0, 1, func(b []byte) []byte {
+						return append(b, make([]byte, 8)...)
+					})
+				} else {
+					b = appendFullBox(b, "smhd", 0, 0, func(b []byte) []byte {
+						return append(b, make([]byte, 4)...)
+					})
+				}
+				b = appendBox(b, "dinf", func(b []byte) []byte {
+					return appendFullBox(b, "dref", 0, 0, func(b []byte) []byte {
+						b = binary.BigEndian.AppendUint32(b, 1)
+						return appendFullBox(b, "url ", 0, 1, func(b []byte) []byte { return b })
+					})
+				})
+				return appendBox(b, "stbl", func(b []byte) []byte {
+					b = appendFullBox(b, "stsd", 0, 0, func(b []byte) []byte {
+						b = binary.BigEndian.AppendUint32(b, 1)
+						if video {
+							return m.appendVideoSampleEntry(b)
+						}
+						return m.appendAudioSampleEntry(b)
+					})
+					for _, typ := range []string{"stts", "stsc", "stco"} {
+						b = appendFullBox(b, typ, 0, 0, func(b []byte) []byte {
+							return binary.BigEndian.AppendUint32(b, 0)
+						})
+					}
+					return appendFullBox(b, "stsz", 0, 0, func(b []byte) []byte {
+						return append(b, make([]byte, 8)...)
+					})
+				})
+			})
+		})
+	})
+}
+
+func (m *mp4Muxer) appendVideoSampleEntry(b []byte) []byte {
+	return appendBox(b, "avc1", func(b []byte) []byte {
+		b = append(b, make([]byte, 6)...)
+		b = binary.BigEndian.AppendUint16(b, 1) // data reference index
+		b = append(b, make([]byte, 16)...)
+		b = binary.BigEndian.AppendUint16(b, uint16(m.cfg.width))
+		b = binary.BigEndian.AppendUint16(b, uint16(m.cfg.height))
+		b = binary.BigEndian.AppendUint32(b, 0x00480000) // 72 dpi
+		b = binary.BigEndian.AppendUint32(b, 0x00480000)
+		b = append(b, make([]byte, 4)...)
+		b = binary.BigEndian.AppendUint16(b, 1) // frame count
+		b = append(b, make([]byte, 32)...)      // compressor name
+		b = binary.BigEndian.AppendUint16(b, 0x0018)
+		b = binary.BigEndian.AppendUint16(b, 0xffff)
+		return appendBox(b, "avcC", func(b []byte) []byte {
+			return append(b, m.cfg.avcC...)
+		})
+	})
+}
+
+func (m *mp4Muxer) appendAudioSampleEntry(b []byte) []byte {
+	// sowt is QuickTime's 16 bit little endian PCM, understood by ffmpeg and most players.
+	return appendBox(b, "sowt", func(b []byte) []byte {
+		b = append(b, make([]byte, 6)...)
+		b = binary.BigEndian.AppendUint16(b, 1)
+		b = append(b, make([]byte, 8)...) // version, revision, vendor
+		b = binary.BigEndian.AppendUint16(b, m.cfg.audio.Channel)
+		b = binary.BigEndian.AppendUint16(b, m.cfg.audio.Bitrate)
+		b = append(b, make([]byte, 4)...)
+		return binary.BigEndian.AppendUint32(b, uint32(m.cfg.audio.Frequency)<<16)
+	})
+}
+
+func appendBox(b []byte, typ string, content func([]byte) []byte) []byte {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0)
+	b = append(b, typ...)
+	b = content(b)
+	binary.BigEndian.PutUint32(b[start:], uint32(len(b)-start))
+	return b
+}
+
+func appendFullBox(b []byte, typ string, version uint8, flags uint32, content func([]byte) []byte) []byte {
+	return appendBox(b, typ, func(b []byte) []byte {
+		b = binary.BigEndian.AppendUint32(b, uint32(version)<<24|flags&0xffffff)
+		return content(b)
+	})
+}
+
+func appendMatrix(b []byte) []byte {
+	for _, v := range mp4Matrix {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// scale converts d to units of timescale.
+func scale(d time.Duration, timescale uint64) uint64 {
+	if d < 0 {
+		return 0
+	}
+	return uint64(d) * timescale / uint64(time.Second)
+}
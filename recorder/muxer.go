@@ -0,0 +1,74 @@
+package recorder
+
+import (
+	"io"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Format is a container format recordings are written in.
+type Format int
+
+const (
+	FormatMP4 Format = iota
+	FormatMKV
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatMP4:
+		return "mp4"
+	case FormatMKV:
+		return "mkv"
+	}
+	return "unknown"
+}
+
+// Ext returns the file name extension for the format including the leading dot.
+func (f Format) Ext() string {
+	return "." + f.String()
+}
+
+// ParseFormat returns the Format named by s.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "mp4":
+		return FormatMP4, nil
+	case "mkv":
+		return FormatMKV, nil
+	}
+	return 0, ErrUnknownFormat
+}
+
+// audioGap is the gap in arriving audio after which it is treated as a new run
+// instead of being appended to the previous samples.
+const audioGap = 500 * time.Millisecond
+
+// trackConfig describes the tracks of a recording. It is known once the first
+// keyframe carrying parameter sets has been received.
+type trackConfig struct {
+	width, height int32
+	avcC          []byte
+	sps           []byte
+	pps           []byte
+	audio         protocol.AudioFormat
+}
+
+// muxer writes samples into a container. Timestamps are relative to the start of the file.
+type muxer interface {
+	writeVideo(pts time.Duration, au accessUnit) error
+	writeAudio(pts time.Duration, pcm []byte) error
+	// Close flushes buffered samples. It does not close the underlying writer.
+	Close() error
+}
+
+func newMuxer(format Format, w io.Writer, cfg trackConfig) (muxer, error) {
+	switch format {
+	case FormatMP4:
+		return newMP4Muxer(w, cfg)
+	case FormatMKV:
+		return newMKVMuxer(w, cfg)
+	}
+	return nil, ErrUnknownFormat
+}
@@ -0,0 +1,404 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+var (
+	testSPS = []byte{0x67, 0x42, 0x00, 0x1f, 0xe9, 0x02, 0x80}
+	testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+)
+
+// annexB joins nalus with start codes as the dongle sends them.
+func annexB(nalus ...[]byte) []byte {
+	var b []byte
+	for _, nalu := range nalus {
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+// testFrame returns the n-th frame of a stream with a keyframe every keyEvery
+// frames, the keyframes carrying the parameter sets.
+func testFrame(n, keyEvery int) []byte {
+	if n%keyEvery == 0 {
+		return annexB(testSPS, testPPS, []byte{0x65, 0x88, byte(n), byte(n >> 8)})
+	}
+	return annexB([]byte{0x41, 0x9a, byte(n), byte(n >> 8)})
+}
+
+func testTrackConfig() trackConfig {
+	return trackConfig{
+		width:  1280,
+		height: 720,
+		avcC:   avcDecoderConfig(testSPS, testPPS),
+		sps:    testSPS,
+		pps:    testPPS,
+		audio:  protocol.AudioDecodeTypes[1],
+	}
+}
+
+// testPCM returns d of 44.1kHz stereo PCM, numbered by n.
+func testPCM(n int, d time.Duration) []byte {
+	pcm := make([]byte, int(d*44100/time.Second)*4)
+	for i := range pcm {
+		pcm[i] = byte(n + i)
+	}
+	return pcm
+}
+
+// mp4Box is a box of an MP4 file, body excluding its header.
+type mp4Box struct {
+	typ      string
+	start    int
+	body     []byte
+	children []mp4Box
+}
+
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "dinf": true,
+	"stbl": true, "mvex": true, "moof": true, "traf": true,
+}
+
+// parseMP4 parses the boxes of b, which must fill it exactly, and the boxes
+// of the containers among them. base is the offset of b in the file.
+func parseMP4(t *testing.T, b []byte, base int) []mp4Box {
+	t.Helper()
+	var boxes []mp4Box
+	for off := 0; off < len(b); {
+		if len(b)-off < 8 {
+			t.Fatalf("%d bytes left at %d for a box header", len(b)-off, base+off)
+		}
+		size := int(binary.BigEndian.Uint32(b[off:]))
+		typ := string(b[off+4 : off+8])
+		if size < 8 || off+size > len(b) {
+			t.Fatalf("box %q at %d: size %d overruns its parent of %d bytes", typ, base+off, size, len(b))
+		}
+		box := mp4Box{typ: typ, start: base + off, body: b[off+8 : off+size]}
+		if mp4Containers[typ] {
+			box.children = parseMP4(t, box.body, box.start+8)
+		}
+		boxes = append(boxes, box)
+		off += size
+	}
+	return boxes
+}
+
+func (b mp4Box) child(t *testing.T, typ string) mp4Box {
+	t.Helper()
+	for _, c := range b.children {
+		if c.typ == typ {
+			return c
+		}
+	}
+	t.Fatalf("%s has no %s", b.typ, typ)
+	return mp4Box{}
+}
+
+// mp4Track is what the fragments of an MP4 file hold for a track.
+type mp4Track struct {
+	decodeTimes []uint64
+	durations   []uint32
+	samples     [][]byte
+	data        []byte
+}
+
+// readFragments reads the samples of every fragment of the file, checking
+// that the data offsets of the runs point into the mdat following the moof.
+func readFragments(t *testing.T, file []byte) map[uint32]*mp4Track {
+	t.Helper()
+	boxes := parseMP4(t, file, 0)
+	if len(boxes) < 2 || boxes[0].typ != "ftyp" || boxes[1].typ != "moov" {
+		t.Fatalf("file does not start with ftyp and moov")
+	}
+	tracks := map[uint32]*mp4Track{}
+	rest := boxes[2:]
+	if len(rest)%2 != 0 {
+		t.Fatalf("%d boxes after moov, want moof and mdat pairs", len(rest))
+	}
+	for i := 0; i < len(rest); i += 2 {
+		moof, mdat := rest[i], rest[i+1]
+		if moof.typ != "moof" || mdat.typ != "mdat" {
+			t.Fatalf("boxes %q and %q, want moof and mdat", moof.typ, mdat.typ)
+		}
+		mdatStart, mdatEnd := mdat.start+8, mdat.start+8+len(mdat.body)
+		for _, traf := range moof.children {
+			if traf.typ != "traf" {
+				continue
+			}
+			tfhd := traf.child(t, "tfhd").body
+			id := binary.BigEndian.Uint32(tfhd[4:])
+			flags := binary.BigEndian.Uint32(tfhd) & 0xffffff
+			var defaultSize uint32
+			if flags&0x10 != 0 {
+				defaultSize = binary.BigEndian.Uint32(tfhd[12:])
+			}
+			decodeTime := binary.BigEndian.Uint64(traf.child(t, "tfdt").body[4:])
+
+			trun := traf.child(t, "trun").body
+			trunFlags := binary.BigEndian.Uint32(trun) & 0xffffff
+			count := int(binary.BigEndian.Uint32(trun[4:]))
+			offset := moof.start + int(int32(binary.BigEndian.Uint32(trun[8:])))
+			if offset < mdatStart || offset > mdatEnd {
+				t.Fatalf("track %d: data offset %d outside of mdat [%d, %d)", id, offset, mdatStart, mdatEnd)
+			}
+
+			track := tracks[id]
+			if track == nil {
+				track = &mp4Track{}
+				tracks[id] = track
+			}
+			entries := trun[12:]
+			for n := 0; n < count; n++ {
+				size, duration := defaultSize, uint32(1)
+				if trunFlags&0x100 != 0 {
+					duration, entries = binary.BigEndian.Uint32(entries), entries[4:]
+				}
+				if trunFlags&0x200 != 0 {
+					size, entries = binary.BigEndian.Uint32(entries), entries[4:]
+				}
+				if trunFlags&0x400 != 0 {
+					entries = entries[4:]
+				}
+				if offset+int(size) > mdatEnd {
+					t.Fatalf("track %d: sample %d of %d bytes at %d overruns mdat ending at %d", id, n, size, offset, mdatEnd)
+				}
+				sample := file[offset : offset+int(size)]
+				track.decodeTimes = append(track.decodeTimes, decodeTime)
+				track.durations = append(track.durations, duration)
+				track.samples = append(track.samples, sample)
+				track.data = append(track.data, sample...)
+				decodeTime += uint64(duration)
+				offset += int(size)
+			}
+		}
+	}
+	return tracks
+}
+
+func TestMP4Muxer(t *testing.T) {
+	var buf bytes.Buffer
+	m, err := newMP4Muxer(&buf, testTrackConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const frames = 60
+	var wantVideo [][]byte
+	var wantAudio []byte
+	for n := 0; n < frames; n++ {
+		pts := time.Duration(n) * 40 * time.Millisecond
+		au := parseAccessUnit(testFrame(n, 25))
+		wantVideo = append(wantVideo, au.avcc)
+		if err := m.writeVideo(pts, au); err != nil {
+			t.Fatal(err)
+		}
+		pcm := testPCM(n, 40*time.Millisecond)
+		wantAudio = append(wantAudio, pcm...)
+		if err := m.writeAudio(pts, pcm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tracks := readFragments(t, buf.Bytes())
+	video := tracks[mp4VideoTrackID]
+	if video == nil || len(video.samples) != frames {
+		t.Fatalf("video track holds %d samples, want %d", len(video.samples), frames)
+	}
+	for n, sample := range video.samples {
+		if !bytes.Equal(sample, wantVideo[n]) {
+			t.Errorf("video sample %d = %x, want %x", n, sample, wantVideo[n])
+		}
+		if want := uint64(n) * mp4VideoTimescale / 25; video.decodeTimes[n] != want {
+			t.Errorf("video sample %d decodes at %d, want %d", n, video.decodeTimes[n], want)
+		}
+		if video.durations[n] != mp4VideoTimescale/25 {
+			t.Errorf("video sample %d lasts %d, want %d", n, video.durations[n], mp4VideoTimescale/25)
+		}
+	}
+	audio := tracks[mp4AudioTrackID]
+	if audio == nil || !bytes.Equal(audio.data, wantAudio) {
+		t.Fatalf("audio track does not hold the PCM written")
+	}
+	if audio.decodeTimes[0] != 0 {
+		t.Errorf("audio decodes from %d, want 0", audio.decodeTimes[0])
+	}
+}
+
+// ebmlElement is an element of a Matroska file, data excluding its header.
+type ebmlElement struct {
+	id   uint32
+	data []byte
+}
+
+// readVint reads a variable length integer of EBML, keeping its length
+// marker when it is an ID.
+func readVint(t *testing.T, b []byte, id bool) (uint64, int) {
+	t.Helper()
+	if len(b) == 0 || b[0] == 0 {
+		t.Fatalf("invalid EBML integer %x", b)
+	}
+	n := 1
+	for b[0]&(0x80>>(n-1)) == 0 {
+		n++
+	}
+	if len(b) < n {
+		t.Fatalf("EBML integer of %d bytes in %d", n, len(b))
+	}
+	v := uint64(b[0])
+	if !id {
+		v &= 0xff >> n
+	}
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// parseEBML parses the elements of b, which must fill it exactly. The size
+// of the Segment, written as unknown, spans the rest of b.
+func parseEBML(t *testing.T, b []byte) []ebmlElement {
+	t.Helper()
+	var elems []ebmlElement
+	for len(b) > 0 {
+		id, n := readVint(t, b, true)
+		b = b[n:]
+		size, n := readVint(t, b, false)
+		b = b[n:]
+		if id == mkvIDSegment {
+			if size != 1<<56-1 {
+				t.Fatalf("segment of size %d, want unknown", size)
+			}
+			size = uint64(len(b))
+		}
+		if size > uint64(len(b)) {
+			t.Fatalf("element %x of %d bytes overruns its parent with %d left", id, size, len(b))
+		}
+		elems = append(elems, ebmlElement{id: uint32(id), data: b[:size]})
+		b = b[size:]
+	}
+	return elems
+}
+
+// mkvBlock is a SimpleBlock with its absolute timestamp in milliseconds.
+type mkvBlock struct {
+	track     byte
+	timestamp int64
+	key       bool
+	data      []byte
+}
+
+func readMKV(t *testing.T, file []byte) []mkvBlock {
+	t.Helper()
+	top := parseEBML(t, file)
+	if len(top) != 2 || top[0].id != mkvIDEBML || top[1].id != mkvIDSegment {
+		t.Fatalf("file is not an EBML header and a segment")
+	}
+	parseEBML(t, top[0].data)
+
+	var blocks []mkvBlock
+	seen := map[uint32]bool{}
+	for _, elem := range parseEBML(t, top[1].data) {
+		seen[elem.id] = true
+		if elem.id != mkvIDCluster {
+			parseEBML(t, elem.data)
+			continue
+		}
+		children := parseEBML(t, elem.data)
+		if len(children) == 0 || children[0].id != mkvIDTimestamp {
+			t.Fatalf("cluster does not start with its timestamp")
+		}
+		var clusterTime int64
+		for _, c := range children[0].data {
+			clusterTime = clusterTime<<8 | int64(c)
+		}
+		for _, block := range children[1:] {
+			if block.id != mkvIDSimpleBlock || len(block.data) < 4 {
+				t.Fatalf("cluster holds element %x of %d bytes, want a SimpleBlock", block.id, len(block.data))
+			}
+			blocks = append(blocks, mkvBlock{
+				track:     block.data[0] &^ 0x80,
+				timestamp: clusterTime + int64(int16(binary.BigEndian.Uint16(block.data[1:]))),
+				key:       block.data[3]&0x80 != 0,
+				data:      block.data[4:],
+			})
+		}
+	}
+	for _, id := range []uint32{mkvIDInfo, mkvIDTracks, mkvIDCluster} {
+		if !seen[id] {
+			t.Errorf("segment has no element %x", id)
+		}
+	}
+	return blocks
+}
+
+func TestMKVMuxer(t *testing.T) {
+	var buf bytes.Buffer
+	m, err := newMKVMuxer(&buf, testTrackConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const frames = 60
+	var wantVideo [][]byte
+	var wantAudio []byte
+	for n := 0; n < frames; n++ {
+		pts := time.Duration(n) * 40 * time.Millisecond
+		au := parseAccessUnit(testFrame(n, 25))
+		wantVideo = append(wantVideo, au.avcc)
+		if err := m.writeVideo(pts, au); err != nil {
+			t.Fatal(err)
+		}
+		// Audio arriving late by less than audioGap keeps its sample clock.
+		pcm := testPCM(n, 40*time.Millisecond)
+		wantAudio = append(wantAudio, pcm...)
+		if err := m.writeAudio(pts+time.Duration(n%3)*10*time.Millisecond, pcm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var video []mkvBlock
+	var audio []byte
+	var audioTime int64
+	for _, block := range readMKV(t, buf.Bytes()) {
+		switch block.track {
+		case mkvVideoTrack:
+			video = append(video, block)
+		case mkvAudioTrack:
+			if block.timestamp != audioTime {
+				t.Errorf("audio block at %dms, want %dms", block.timestamp, audioTime)
+			}
+			audioTime += 40
+			audio = append(audio, block.data...)
+		default:
+			t.Fatalf("block of track %d", block.track)
+		}
+	}
+	if len(video) != frames {
+		t.Fatalf("%d video blocks, want %d", len(video), frames)
+	}
+	for n, block := range video {
+		if !bytes.Equal(block.data, wantVideo[n]) {
+			t.Errorf("video block %d = %x, want %x", n, block.data, wantVideo[n])
+		}
+		if want := int64(n) * 40; block.timestamp != want {
+			t.Errorf("video block %d at %dms, want %dms", n, block.timestamp, want)
+		}
+		if block.key != (n%25 == 0) {
+			t.Errorf("video block %d key %v", n, block.key)
+		}
+	}
+	if !bytes.Equal(audio, wantAudio) {
+		t.Errorf("audio blocks do not hold the PCM written")
+	}
+}
@@ -0,0 +1,74 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+type Option interface {
+	apply(*Recorder) error
+}
+
+type applyOptionFunc func(*Recorder) error
+
+func (f applyOptionFunc) apply(r *Recorder) error {
+	return f(r)
+}
+
+// WithDir sets the directory recordings are written to.
+func WithDir(dir string) Option {
+	return applyOptionFunc(func(r *Recorder) error {
+		r.dir = dir
+		return nil
+	})
+}
+
+func WithFormat(format Format) Option {
+	return applyOptionFunc(func(r *Recorder) error {
+		r.format = format
+		return nil
+	})
+}
+
+// WithMaxSize rotates to a new file once the current one reaches size bytes.
+// Zero disables size based rotation.
+func WithMaxSize(size int64) Option {
+	return applyOptionFunc(func(r *Recorder) error {
+		r.maxSize = size
+		return nil
+	})
+}
+
+// WithMaxDuration rotates to a new file once the current one spans d.
+// Zero disables duration based rotation.
+func WithMaxDuration(d time.Duration) Option {
+	return applyOptionFunc(func(r *Recorder) error {
+		r.maxDuration = d
+		return nil
+	})
+}
+
+// WithFPS sets the frame rate the dongle was opened with, to whose frame
+// interval the arrival of video frames is snapped. It defaults to 25.
+func WithFPS(fps int32) Option {
+	return applyOptionFunc(func(r *Recorder) error {
+		r.fps = fps
+		return nil
+	})
+}
+
+// WithAudioFormat sets the format of the audio track. Audio in other formats is not recorded.
+func WithAudioFormat(format protocol.AudioFormat) Option {
+	return applyOptionFunc(func(r *Recorder) error {
+		r.audio = format
+		return nil
+	})
+}
+
+func WithLogger(logger Logger) Option {
+	return applyOptionFunc(func(r *Recorder) error {
+		r.logger = logger
+		return nil
+	})
+}
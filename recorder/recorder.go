@@ -0,0 +1,329 @@
+// Package recorder writes the video and audio received from a dongle to
+// fragmented MP4 or Matroska files.
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// rotateGrace is how long a pending rotation waits for a keyframe before the
+// new file is started on whatever frame arrives.
+const rotateGrace = 5 * time.Second
+
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Status describes the state of a Recorder.
+type Status struct {
+	Recording bool          `json:"recording"`
+	Format    string        `json:"format"`
+	Path      string        `json:"path,omitempty"`
+	Size      int64         `json:"size"`
+	Duration  time.Duration `json:"duration"`
+	Files     []string      `json:"files,omitempty"`
+}
+
+// Recorder muxes VideoData and AudioData into files. Feed it every message
+// received from a link with OnData; nothing is written unless it is started.
+type Recorder struct {
+	dir         string
+	format      Format
+	maxSize     int64
+	maxDuration time.Duration
+	fps         int32
+	audio       protocol.AudioFormat
+	logger      Logger
+
+	// now is the clock video and audio are timed by, time.Now but in tests.
+	now func() time.Time
+
+	mu        sync.Mutex
+	recording bool
+	files     []string
+	sps, pps  []byte
+
+	file         *os.File
+	w            *countingWriter
+	mux          muxer
+	fileStart    time.Time
+	lastPTS      time.Duration
+	rotateSince  time.Time
+	droppedAudio int
+}
+
+func New(opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		dir:    ".",
+		format: FormatMP4,
+		fps:    25,
+		audio:  protocol.AudioDecodeTypes[1],
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		if err := opt.apply(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.isValid(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) isValid() error {
+	if r.dir == "" {
+		return ErrEmptyDir
+	}
+	if r.format != FormatMP4 && r.format != FormatMKV {
+		return ErrUnknownFormat
+	}
+	if r.fps <= 0 {
+		return ErrEmptyFPS
+	}
+	if r.audio.Frequency == 0 || r.audio.Channel == 0 || r.audio.Bitrate != 16 {
+		return ErrInvalidAudio
+	}
+	return nil
+}
+
+func (r *Recorder) Debug(msg string, args ...any) {
+	if r.logger != nil {
+		r.logger.Debug(msg, args...)
+	}
+}
+func (r *Recorder) Info(msg string, args ...any) {
+	if r.logger != nil {
+		r.logger.Info(msg, args...)
+	}
+}
+func (r *Recorder) Warn(msg string, args ...any) {
+	if r.logger != nil {
+		r.logger.Warn(msg, args...)
+	}
+}
+func (r *Recorder) Error(msg string, args ...any) {
+	if r.logger != nil {
+		r.logger.Error(msg, args...)
+	}
+}
+
+// Start begins recording. The first file is created when the next keyframe arrives.
+func (r *Recorder) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recording {
+		return ErrAlreadyStarted
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	r.recording = true
+	r.files = nil
+	r.Info("recording started", "dir", r.dir, "format", r.format.String())
+	return nil
+}
+
+// Stop finishes the current file and stops recording.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.recording {
+		return ErrNotStarted
+	}
+	r.recording = false
+	r.Info("recording stopped", "files", r.files)
+	return r.closeFile()
+}
+
+func (r *Recorder) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := Status{
+		Recording: r.recording,
+		Format:    r.format.String(),
+		Files:     append([]string(nil), r.files...),
+	}
+	if r.file != nil {
+		st.Path = r.file.Name()
+		st.Size = r.w.n
+		st.Duration = r.now().Sub(r.fileStart)
+	}
+	return st
+}
+
+// OnData records data if it is video or audio. Its signature matches the
+// callback of link.Link.Communicate.
+func (r *Recorder) OnData(data any) {
+	var err error
+	switch data := data.(type) {
+	case *protocol.VideoData:
+		err = r.writeVideo(data)
+	case *protocol.AudioData:
+		if len(data.Data) > 0 {
+			err = r.writeAudio(data)
+		}
+	default:
+		return
+	}
+	if err != nil {
+		r.Error("record", "error", err.Error())
+	}
+}
+
+func (r *Recorder) writeVideo(data *protocol.VideoData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.recording {
+		return nil
+	}
+
+	au := parseAccessUnit(data.Data)
+	// The frame is released once handled; the parameter sets are kept.
+	if au.sps != nil {
+		r.sps = bytes.Clone(au.sps)
+	}
+	if au.pps != nil {
+		r.pps = bytes.Clone(au.pps)
+	}
+
+	now := r.now()
+	if r.mux != nil && r.shouldRotate(now) {
+		if r.rotateSince.IsZero() {
+			r.rotateSince = now
+		}
+		if au.key || now.Sub(r.rotateSince) >= rotateGrace {
+			if err := r.closeFile(); err != nil {
+				return err
+			}
+		}
+	}
+	if r.mux == nil {
+		if r.sps == nil || r.pps == nil || (!au.key && r.files == nil) {
+			// Wait for a keyframe so that the file is playable from the start.
+			return nil
+		}
+		if err := r.openFile(now, data.Width, data.Height); err != nil {
+			return err
+		}
+	}
+	if len(au.avcc) == 0 {
+		return nil
+	}
+	return r.mux.writeVideo(r.videoPTS(now), au)
+}
+
+// videoPTS returns the timestamp of a video frame arriving at now. Frames are
+// timed by their arrival, on the clock of the audio, as phones send them only
+// when the screen changes. The time is snapped to the frame interval so that
+// the jitter of USB and dispatch does not end up in the file, and kept after
+// the previous frame.
+func (r *Recorder) videoPTS(now time.Time) time.Duration {
+	interval := time.Second / time.Duration(r.fps)
+	pts := (now.Sub(r.fileStart) + interval/2) / interval * interval
+	if pts <= r.lastPTS {
+		pts = r.lastPTS + interval
+	}
+	r.lastPTS = pts
+	return pts
+}
+
+func (r *Recorder) writeAudio(data *protocol.AudioData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mux == nil {
+		return nil
+	}
+	if protocol.AudioDecodeTypes[data.DecodeType] != r.audio {
+		if r.droppedAudio == 0 {
+			r.Warn("audio format differs from recording, dropping", "decodeType", data.DecodeType)
+		}
+		r.droppedAudio++
+		return nil
+	}
+	// Audio is appended at its sample rate; only where a run of it starts,
+	// after silence, is taken from its arrival.
+	return r.mux.writeAudio(r.now().Sub(r.fileStart), data.Data)
+}
+
+func (r *Recorder) shouldRotate(now time.Time) bool {
+	if r.maxSize > 0 && r.w.n >= r.maxSize {
+		return true
+	}
+	return r.maxDuration > 0 && now.Sub(r.fileStart) >= r.maxDuration
+}
+
+func (r *Recorder) openFile(now time.Time, width, height int32) error {
+	name := "carplay-" + now.Format("20060102-150405")
+	path := filepath.Join(r.dir, name+r.format.Ext())
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = filepath.Join(r.dir, fmt.Sprintf("%s-%d%s", name, i, r.format.Ext()))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := &countingWriter{w: f}
+	cfg := trackConfig{
+		width:  width,
+		height: height,
+		avcC:   avcDecoderConfig(r.sps, r.pps),
+		sps:    r.sps,
+		pps:    r.pps,
+		audio:  r.audio,
+	}
+	mux, err := newMuxer(r.format, w, cfg)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file, r.w, r.mux = f, w, mux
+	r.fileStart = now
+	r.lastPTS = -1
+	r.rotateSince = time.Time{}
+	r.droppedAudio = 0
+	r.files = append(r.files, path)
+	r.Info("recording file opened", "path", path)
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.mux == nil {
+		return nil
+	}
+	err := r.mux.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.Info("recording file closed", "path", r.file.Name(), "size", r.w.n)
+	r.file, r.w, r.mux = nil, nil, nil
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,110 @@
+package recorder
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// record feeds frames of a stream with a keyframe every keyEvery frames to a
+// recorder made with opts, the n-th frame arriving at arrival(n), and returns
+// the durations of the video samples of each file it wrote.
+func record(t *testing.T, frames, keyEvery int, arrival func(n int) time.Duration, opts ...Option) [][]uint32 {
+	t.Helper()
+	opts = append([]Option{WithDir(t.TempDir()), WithFPS(10)}, opts...)
+	r, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	var elapsed time.Duration
+	r.now = func() time.Time { return start.Add(elapsed) }
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < frames; n++ {
+		elapsed = arrival(n)
+		r.OnData(&protocol.VideoData{Width: 1280, Height: 720, Data: testFrame(n, keyEvery)})
+	}
+	files := r.Status().Files
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	durations := make([][]uint32, len(files))
+	for i, path := range files {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		video := readFragments(t, file)[mp4VideoTrackID]
+		if video == nil {
+			t.Fatalf("%s has no video", path)
+		}
+		if video.decodeTimes[0] != 0 {
+			t.Errorf("%s starts at %d, want 0", path, video.decodeTimes[0])
+		}
+		durations[i] = video.durations
+	}
+	return durations
+}
+
+// every returns the arrival of frames sent every d.
+func every(d time.Duration) func(int) time.Duration {
+	return func(n int) time.Duration { return time.Duration(n) * d }
+}
+
+// checkFiles checks that the files hold the given numbers of frames, each
+// lasting interval.
+func checkFiles(t *testing.T, durations [][]uint32, interval time.Duration, frames ...int) {
+	t.Helper()
+	if len(durations) != len(frames) {
+		t.Fatalf("%d files, want %d", len(durations), len(frames))
+	}
+	for i, d := range durations {
+		if len(d) != frames[i] {
+			t.Errorf("file %d holds %d frames, want %d", i, len(d), frames[i])
+		}
+		want := uint32(scale(interval, mp4VideoTimescale))
+		for n, duration := range d {
+			if duration != want {
+				t.Errorf("frame %d of file %d lasts %d, want %d", n, i, duration, want)
+			}
+		}
+	}
+}
+
+func TestRotateByDuration(t *testing.T) {
+	// At 10 fps, a second of video has passed on the keyframes every 10 frames.
+	durations := record(t, 35, 10, every(100*time.Millisecond), WithMaxDuration(time.Second))
+	checkFiles(t, durations, 100*time.Millisecond, 10, 10, 10, 5)
+}
+
+func TestRotateBySize(t *testing.T) {
+	// Any file is over a byte, so each keyframe starts a new one.
+	durations := record(t, 20, 5, every(100*time.Millisecond), WithMaxSize(1))
+	checkFiles(t, durations, 100*time.Millisecond, 5, 5, 5, 5)
+}
+
+func TestRotateWaitsForKeyframe(t *testing.T) {
+	// The duration is reached after 5 frames, the keyframe comes after 8.
+	durations := record(t, 20, 8, every(100*time.Millisecond), WithMaxDuration(500*time.Millisecond))
+	checkFiles(t, durations, 100*time.Millisecond, 8, 8, 4)
+}
+
+func TestVideoTimedByArrival(t *testing.T) {
+	// A still screen sends a frame every half second, which lasts as long.
+	durations := record(t, 6, 1, every(500*time.Millisecond), WithMaxDuration(time.Second))
+	checkFiles(t, durations, 500*time.Millisecond, 2, 2, 2)
+}
+
+func TestVideoArrivalSnapped(t *testing.T) {
+	// Frames late or early by less than half the interval keep to the grid.
+	jitter := []time.Duration{0, 30, -40, 10, 45, -20, 0, 35}
+	durations := record(t, len(jitter), 100, func(n int) time.Duration {
+		return time.Duration(n)*100*time.Millisecond + jitter[n]*time.Millisecond
+	})
+	checkFiles(t, durations, 100*time.Millisecond, len(jitter))
+}